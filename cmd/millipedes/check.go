@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/amartorelli/millipedes/pkg/crawler/report"
+	"github.com/amartorelli/millipedes/pkg/crawler/sitemap"
+	"github.com/sirupsen/logrus"
+)
+
+// checkOptions are the flags of the check command
+type checkOptions struct {
+	external  *bool
+	workers   *int
+	maxBroken *int
+	junit     *string
+	json      *string
+}
+
+// checkFlags defines the flags of the check command
+func checkFlags() *checkOptions {
+	return &checkOptions{
+		external:  flag.Bool("external", false, "also check the links to other websites with HEAD requests, without crawling them"),
+		workers:   flag.Int("external-workers", 10, "the number of concurrent requests checking the external links"),
+		maxBroken: flag.Int("max-broken", 0, "exit with status 1 if more broken links than this are found"),
+		junit:     flag.String("junit", "", "the path of the JUnit XML report of the broken links"),
+		json:      flag.String("json", "", "the path of the JSON report of the broken links"),
+	}
+}
+
+// runCheck prints the broken links found by the crawl grouped by page, writes the reports and returns
+// the exit status: 1 if there are more broken links than allowed, 2 if a report couldn't be written,
+// 3 if the crawl isn't complete, e.g. interrupted, so that the links of the pages left weren't checked.
+// The external links must have been checked before, and the sitemap is closed once streamed.
+func runCheck(sm sitemap.Sitemap, website string, complete bool, opts *checkOptions) int {
+	r := report.NewCheckReport(website, report.BrokenLinks(sm))
+	if err := sm.Close(); err != nil {
+		logrus.Error(err)
+	}
+
+	status := 0
+	if err := r.WriteText(os.Stdout); err != nil {
+		logrus.Error(err)
+		status = 2
+	}
+	if err := writeReport(*opts.junit, r.WriteJUnit); err != nil {
+		logrus.Error(err)
+		status = 2
+	}
+	if err := writeReport(*opts.json, r.WriteJSON); err != nil {
+		logrus.Error(err)
+		status = 2
+	}
+	if status == 0 && !complete {
+		logrus.Error("the crawl was stopped before being complete, the links of the pages left weren't checked")
+		status = 3
+	}
+	if status == 0 && r.Broken > *opts.maxBroken {
+		logrus.Errorf("%d broken links found, more than the %d allowed", r.Broken, *opts.maxBroken)
+		status = 1
+	}
+	return status
+}
+
+// writeReport writes a report to the file at path, unless it's empty
+func writeReport(path string, write func(w io.Writer) error) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating the report %s: %s", path, err)
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing the report %s: %s", path, err)
+	}
+	return f.Close()
+}
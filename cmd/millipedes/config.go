@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// config is the content of the JSON configuration file
+type config struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+	// TrackingParams replaces the tracking query parameters set with the flag, if present
+	TrackingParams []string `json:"tracking_params"`
+}
+
+// loadConfig reads the configuration file, an empty path returns an empty configuration
+func loadConfig(path string) (*config, error) {
+	cfg := &config{}
+	if path == "" {
+		return cfg, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening config file: %s", err)
+	}
+	defer f.Close()
+
+	err = json.NewDecoder(f).Decode(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %s", path, err)
+	}
+	return cfg, nil
+}
+
+// stringList is a flag that can be repeated to collect multiple values
+type stringList []string
+
+// String returns the values of the flag
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set adds a value to the flag
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
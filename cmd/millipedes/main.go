@@ -2,14 +2,21 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/amartorelli/millipedes/pkg/crawler"
 	"github.com/amartorelli/millipedes/pkg/crawler/fetcher"
+	"github.com/amartorelli/millipedes/pkg/crawler/filter"
+	"github.com/amartorelli/millipedes/pkg/crawler/normalizer"
+	"github.com/amartorelli/millipedes/pkg/crawler/parser"
 	"github.com/amartorelli/millipedes/pkg/crawler/render"
+	"github.com/amartorelli/millipedes/pkg/crawler/report"
+	"github.com/amartorelli/millipedes/pkg/crawler/seen"
 	"github.com/amartorelli/millipedes/pkg/crawler/sitemap"
 
 	"github.com/sirupsen/logrus"
@@ -23,10 +30,48 @@ func main() {
 	// flags
 	website := flag.String("website", "https://example.com/", "the website to be crawled")
 	workers := flag.Int("workers", 100, "the number of concurrent workers")
-	queueLen := flag.Int("queue", 1000, "the queue size to store pending urls that need parsing")
-	rate := flag.Int("rate", 200, "the rate limiter interval in ms")
+	queueLen := flag.Int("queue", 1000, "the number of pending urls kept in memory before spilling them to disk")
+	rate := flag.Int("rate", 200, "the minimum interval in ms between two requests to the same host")
+	maxAttempts := flag.Int("max-attempts", fetcher.DefaultRetryPolicy.MaxAttempts, "the maximum number of requests sent for a page failing with a timeout, a network error or a 5xx/429 response")
+	maxBodySize := flag.Int64("max-body-size", fetcher.DefaultMaxBodySize, "the maximum size in bytes of the pages downloaded, bigger pages are aborted (0 means no limit)")
+	warnRedirectHops := flag.Int("warn-redirect-hops", 2, "warn about the redirect chains with more hops than this, as well as redirect loops")
+	follow := flag.String("follow", joinKinds(crawler.DefaultFollow), "comma separated kinds of links crawled, the others are only recorded: "+joinKinds(parser.Kinds))
+	reportNonNavigable := flag.Bool("report-non-navigable", false, "list the contact and JavaScript links (mailto:, tel:, javascript:, data:...) found, which aren't crawled")
+	followNofollow := flag.Bool("follow-nofollow", false, "crawl the links marked as nofollow by rel=\"nofollow\", meta robots or X-Robots-Tag")
+	hostBurst := flag.Int("host-burst", 1, "the number of requests a host can receive in a burst")
+	hostConcurrency := flag.Int("host-concurrency", 4, "the maximum number of concurrent requests to the same host (0 means no limit)")
+	store := flag.String("store", "memory", "where the sitemap is stored: memory, or disk to store it in the -store-path database, which survives a crash")
+	storePath := flag.String("store-path", "millipedes.db", "the path of the database the sitemap is stored in with -store=disk")
+	stateDir := flag.String("state-dir", "", "the directory the state of the crawl is checkpointed to, so that it can be resumed with -resume")
+	checkpointInterval := flag.Duration("checkpoint-interval", time.Minute, "the interval between two checkpoints of the crawl to -state-dir")
+	resume := flag.String("resume", "", "resume the crawl checkpointed to the directory, where it keeps being checkpointed")
+	seenMode := flag.String("seen", "memory", "the set of URLs already seen: memory (exact), bloom (approximate, with bounded memory) or disk (exact, in a temporary database)")
+	seenFPRate := flag.Float64("seen-fp-rate", seen.DefaultFalsePositiveRate, "the maximum probability of an unseen URL not being crawled with -seen=bloom")
 	loglevel := flag.String("loglevel", "info", "log level (debug/info/warn/fatal")
-	flag.Parse()
+	userAgent := flag.String("useragent", "millipedes", "the User-Agent sent to the website and used to evaluate robots.txt")
+	ignoreRobots := flag.Bool("ignore-robots", false, "don't honor robots.txt rules and Crawl-delay")
+	maxDepth := flag.Int("maxdepth", 0, "the maximum number of links followed from the website (0 means no limit)")
+	maxPages := flag.Int("maxpages", 0, "the maximum number of pages crawled (0 means no limit)")
+	maxDuration := flag.Duration("maxduration", 0, "the maximum duration of the crawl, e.g. 10m (0 means no limit)")
+	scopeMode := flag.String("scope", "subdomains", "the hosts to crawl: host, subdomains, domain (registrable domain) or allowlist")
+	matchScheme := flag.Bool("match-scheme", false, "only crawl links with the same scheme as the website")
+	matchPort := flag.Bool("match-port", false, "only crawl links with the same port as the website")
+	var allowedHosts stringList
+	flag.Var(&allowedHosts, "allow-host", "a host crawled with -scope=allowlist, prefix it with a dot to include its subdomains (can be repeated)")
+	trackingParams := flag.String("tracking-params", strings.Join(normalizer.DefaultTrackingParams, ","), "comma separated query parameters removed from links, * matches any suffix")
+	stripTrailingSlash := flag.Bool("strip-trailing-slash", false, "consider links with and without a trailing slash the same page")
+	configPath := flag.String("config", "", "the path of a JSON configuration file")
+	var include, exclude stringList
+	flag.Var(&include, "include", "only crawl links matching the rule, either re:<regexp>, glob:<glob> or prefix:<path> (can be repeated)")
+	flag.Var(&exclude, "exclude", "don't crawl links matching the rule, either re:<regexp>, glob:<glob> or prefix:<path> (can be repeated)")
+	// millipedes check crawls the website and reports its broken links instead of rendering the sitemap
+	var check *checkOptions
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "check" {
+		check = checkFlags()
+		args = args[1:]
+	}
+	flag.CommandLine.Parse(args)
 
 	// logging
 	switch *loglevel {
@@ -45,36 +90,162 @@ func main() {
 	}
 	logrus.SetFormatter(formatter)
 
-	fetcher := fetcher.NewHTTPFetcher()
-	sitemap := sitemap.NewMemorySitemap()
-	c, err := crawler.NewCrawler(*website, *workers, *queueLen, *rate, fetcher, sitemap)
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	filter, err := filter.New(append(cfg.Include, include...), append(cfg.Exclude, exclude...))
 	if err != nil {
 		logrus.Fatal(err)
 	}
 
-	c.Start()
+	mode, err := crawler.ParseScopeMode(*scopeMode)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	scope := crawler.ScopePolicy{Mode: mode, Hosts: allowedHosts, MatchScheme: *matchScheme, MatchPort: *matchPort}
 
-	run := true
-	for run {
-		select {
-		case sig := <-sigs:
-			logrus.Infof("received signal %s, gracefully shutting down: processing all remaining elements in the queue before exiting\n", sig)
-			run = false
-		case <-time.Tick(1 * time.Second):
-			if c.IsDone() {
-				run = false
-			}
+	params := cfg.TrackingParams
+	if params == nil {
+		params = strings.Split(*trackingParams, ",")
+	}
+	normalizer := normalizer.New(params, *stripTrailingSlash)
+
+	kinds := []parser.Kind{}
+	for _, name := range strings.Split(*follow, ",") {
+		kind, err := parser.ParseKind(strings.TrimSpace(name))
+		if err != nil {
+			logrus.Fatal(err)
 		}
+		kinds = append(kinds, kind)
+	}
+
+	retry := fetcher.DefaultRetryPolicy
+	retry.MaxAttempts = *maxAttempts
+	fetcher := fetcher.NewHTTPFetcher(*userAgent, retry, fetcher.WithMaxBodySize(*maxBodySize))
+	if *resume != "" {
+		*stateDir = *resume
+	}
+	sm, err := newSitemap(*store, *storePath, *resume != "")
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	opts := []crawler.Option{
+		crawler.WithLimits(crawler.Limits{MaxDepth: *maxDepth, MaxPages: *maxPages, MaxDuration: *maxDuration}),
+		crawler.WithFilter(filter),
+		crawler.WithScope(scope),
+		crawler.WithNormalizer(normalizer),
+		crawler.WithHostLimits(*hostBurst, *hostConcurrency),
+		crawler.WithFollow(kinds...),
+		crawler.WithUserAgent(*userAgent),
+	}
+	if *followNofollow {
+		opts = append(opts, crawler.WithFollowNofollow())
+	}
+	if !*ignoreRobots {
+		opts = append(opts, crawler.WithRobots(*userAgent))
+	}
+	seenSet, err := newSeenSet(*seenMode, *seenFPRate)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	opts = append(opts, crawler.WithSeenSet(seenSet))
+	if *stateDir != "" {
+		if err := os.MkdirAll(*stateDir, 0700); err != nil {
+			logrus.Fatal(err)
+		}
+		opts = append(opts, crawler.WithCheckpoints(*stateDir, *checkpointInterval))
+	}
+	c, err := crawler.NewCrawler(*website, *workers, *queueLen, *rate, fetcher, sm, opts...)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	if *resume != "" {
+		if err := c.Resume(*resume); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+
+	c.Start()
+
+	select {
+	case sig := <-sigs:
+		logrus.Infof("received signal %s, gracefully shutting down: waiting for the pages being processed before exiting\n", sig)
+	case <-c.Done():
 	}
 
 	// show results
+	complete := c.Complete()
 	c.Shutdown()
 	logrus.Info("done")
-	sm := c.Sitemap()
+	if bloom, ok := seenSet.(*seen.BloomSet); ok {
+		logrus.Infof("%d urls seen, with an estimated false positive rate of %g", bloom.Len(), bloom.FalsePositiveRate())
+	}
+	if *reportNonNavigable {
+		sm.RangePages(func(p sitemap.Page) bool {
+			for _, l := range p.NonNavigable {
+				logrus.Infof("%s links to %s", p.URL, l.URL)
+			}
+			return true
+		})
+	}
+	if check != nil && *check.external {
+		logrus.Infof("%d external links checked", c.CheckExternal(*check.workers))
+	}
+	// the reports and the render stream the sitemap rather than loading it, as it may be on disk
+	for _, chain := range report.FlagRedirectChains(report.RedirectChains(report.Redirects(sm)), *warnRedirectHops) {
+		logrus.Warnf("redirect chain with %d hops: %s", chain.Hops(), chain)
+	}
+	if check != nil {
+		os.Exit(runCheck(sm, *website, complete, check))
+	}
+	for _, broken := range report.BrokenLinks(sm) {
+		logrus.Warnf("broken link %s", broken)
+	}
 	r := render.NewSigmajsRender(":9876")
 	r.UpdateSitemap(sm)
+	if err := sm.Close(); err != nil {
+		logrus.Error(err)
+	}
 	err = r.Render()
 	if err != nil {
 		logrus.Fatal(err)
 	}
 }
+
+// newSitemap returns the sitemap backend selected with -store. When resuming a crawl the sitemap
+// on disk is reopened, and replaced by the one of the checkpoint as it may hold pages crawled after it.
+func newSitemap(store, path string, resume bool) (sitemap.Sitemap, error) {
+	switch store {
+	case "memory":
+		return sitemap.NewMemorySitemap(), nil
+	case "disk":
+		if _, err := os.Stat(path); err == nil && !resume {
+			return nil, fmt.Errorf("%s already exists, remove it to start a new crawl", path)
+		}
+		return sitemap.NewDiskSitemap(path)
+	}
+	return nil, fmt.Errorf("unknown store %q, expecting memory or disk", store)
+}
+
+// newSeenSet returns the set of seen URLs selected with -seen
+func newSeenSet(mode string, fpRate float64) (seen.Set, error) {
+	switch mode {
+	case "memory":
+		return seen.NewShardedSet(seen.DefaultShards), nil
+	case "bloom":
+		return seen.NewBloomSet(seen.DefaultBloomCapacity, fpRate)
+	case "disk":
+		return seen.NewDiskSet("")
+	}
+	return nil, fmt.Errorf("unknown seen set %q, expecting memory, bloom or disk", mode)
+}
+
+// joinKinds returns a comma separated list of kinds of links
+func joinKinds(kinds []parser.Kind) string {
+	names := make([]string, 0, len(kinds))
+	for _, k := range kinds {
+		names = append(names, string(k))
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,34 @@
+;(function() {
+  'use strict';
+
+  // sigma doesn't ship a renderer for the edge labels drawn when drawEdgeLabels is set:
+  // this one writes the label along the middle of the straight edges
+  sigma.utils.pkg('sigma.canvas.edges.labels');
+
+  sigma.canvas.edges.labels.def = function(edge, source, target, context, settings) {
+    if (typeof edge.label !== 'string' || edge.label === '' || source === target)
+      return;
+
+    var prefix = settings('prefix') || '',
+        x1 = source[prefix + 'x'],
+        y1 = source[prefix + 'y'],
+        x2 = target[prefix + 'x'],
+        y2 = target[prefix + 'y'],
+        angle = Math.atan2(y2 - y1, x2 - x1),
+        fontSize = settings('edgeLabelSize') || 10;
+
+    // keep the text upright whatever the direction of the edge
+    if (x2 < x1)
+      angle += Math.PI;
+
+    context.save();
+    context.font = fontSize + 'px ' + settings('font');
+    context.fillStyle = settings('edgeLabelColor') || '#555555';
+    context.textAlign = 'center';
+    context.textBaseline = 'alphabetic';
+    context.translate((x1 + x2) / 2, (y1 + y2) / 2);
+    context.rotate(angle);
+    context.fillText(edge.label, 0, -fontSize / 3);
+    context.restore();
+  };
+})();
@@ -0,0 +1,337 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/amartorelli/millipedes/pkg/crawler/frontier"
+	"github.com/amartorelli/millipedes/pkg/crawler/seen"
+	"github.com/amartorelli/millipedes/pkg/crawler/sitemap"
+	"github.com/sirupsen/logrus"
+)
+
+// checkpointFile is the name of the file the state of the crawl is saved to in the state directory
+const checkpointFile = "checkpoint.jsonl"
+
+// checkpointHeader is the first record of a checkpoint
+type checkpointHeader struct {
+	Entrypoint string    `json:"entrypoint"`
+	Queued     int64     `json:"queued"`
+	Time       time.Time `json:"time"`
+}
+
+// linksRecord holds the links from a url of the sitemap
+type linksRecord struct {
+	URL   string         `json:"url"`
+	Links []sitemap.Link `json:"links"`
+}
+
+// checkpointRecord is a line of a checkpoint, only one of its fields is set
+type checkpointRecord struct {
+	Header *checkpointHeader `json:"header,omitempty"`
+	Item   *frontier.Item    `json:"item,omitempty"`
+	Seen   string            `json:"seen,omitempty"`
+	// SeenFilter is the encoding of a set of seen URLs which can't list them, e.g. a Bloom filter
+	SeenFilter []byte        `json:"seen_filter,omitempty"`
+	Links      *linksRecord  `json:"links,omitempty"`
+	Page       *sitemap.Page `json:"page,omitempty"`
+}
+
+// pendingItem is a queued URL which hasn't been fully processed yet, in the order it was queued
+type pendingItem struct {
+	item frontier.Item
+	seq  int64
+}
+
+// checkpoints periodically saves the state of the crawl to a directory
+type checkpoints struct {
+	dir      string
+	interval time.Duration
+	pending  map[string]pendingItem
+	seq      int64
+	running  bool
+	// mux serializes the checkpoints, so that an older one doesn't replace a newer one
+	mux     sync.Mutex
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// WithCheckpoints periodically saves the frontier, the seen URLs and the sitemap to dir, so that the
+// crawl can be continued with Resume after being interrupted. The state is also saved on Shutdown.
+func WithCheckpoints(dir string, interval time.Duration) Option {
+	return func(c *Crawler) {
+		c.checkpoints = &checkpoints{
+			dir:      dir,
+			interval: interval,
+			pending:  make(map[string]pendingItem, 0),
+			stop:     make(chan struct{}),
+			stopped:  make(chan struct{}),
+		}
+	}
+}
+
+// trackPending records a queued URL as pending until it's fully processed
+func (c *Crawler) trackPending(item frontier.Item) {
+	if c.checkpoints == nil {
+		return
+	}
+	c.pendingMux.Lock()
+	c.checkpoints.seq++
+	c.checkpoints.pending[item.URL] = pendingItem{item: item, seq: c.checkpoints.seq}
+	c.pendingMux.Unlock()
+}
+
+// untrackPending records a URL as fully processed, links included
+func (c *Crawler) untrackPending(url string) {
+	if c.checkpoints == nil {
+		return
+	}
+	c.pendingMux.Lock()
+	delete(c.checkpoints.pending, url)
+	c.pendingMux.Unlock()
+}
+
+// runCheckpoints saves the state of the crawl every interval, until stopped
+func (c *Crawler) runCheckpoints() {
+	defer close(c.checkpoints.stopped)
+	if c.checkpoints.interval <= 0 {
+		<-c.checkpoints.stop
+		return
+	}
+	ticker := time.NewTicker(c.checkpoints.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.Checkpoint(); err != nil {
+				logrus.Error(err)
+			}
+		case <-c.checkpoints.stop:
+			return
+		}
+	}
+}
+
+// stopCheckpoints stops saving the state periodically
+func (c *Crawler) stopCheckpoints() {
+	if !c.checkpoints.running {
+		return
+	}
+	select {
+	case <-c.checkpoints.stop:
+	default:
+		close(c.checkpoints.stop)
+	}
+	<-c.checkpoints.stopped
+}
+
+// checkpointState is the state of the crawl, taken while the processing is paused and written after
+type checkpointState struct {
+	header  checkpointHeader
+	pending []pendingItem
+	// seen are the seen URLs if they can be listed, seenFilter is the encoding of the set otherwise
+	seen       []string
+	seenFilter []byte
+	sitemap    sitemap.Snapshot
+}
+
+// Checkpoint saves the state of the crawl to the state directory, waiting for the pages being processed
+// so that the state is consistent. The processing is paused only while the state is taken, not while
+// it's written. The previous checkpoint is replaced only once the new one is complete.
+func (c *Crawler) Checkpoint() error {
+	if c.checkpoints == nil {
+		return fmt.Errorf("checkpoints are disabled")
+	}
+	c.checkpoints.mux.Lock()
+	defer c.checkpoints.mux.Unlock()
+
+	start := time.Now()
+	c.processMux.Lock()
+	state, err := c.checkpointState()
+	c.processMux.Unlock()
+	if err != nil {
+		return fmt.Errorf("error creating the checkpoint: %s", err)
+	}
+	defer state.sitemap.Close()
+
+	tmp, err := ioutil.TempFile(c.checkpoints.dir, checkpointFile+".tmp-")
+	if err != nil {
+		return fmt.Errorf("error creating the checkpoint: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	err = state.write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(c.checkpoints.dir, checkpointFile))
+	}
+	if err != nil {
+		return fmt.Errorf("error writing the checkpoint: %s", err)
+	}
+	logrus.Debugf("checkpoint saved in %s", time.Since(start))
+	return nil
+}
+
+// checkpointState takes the state of the crawl, the processing must be paused
+func (c *Crawler) checkpointState() (*checkpointState, error) {
+	state := &checkpointState{
+		header: checkpointHeader{Entrypoint: c.entrypoint, Queued: atomic.LoadInt64(&c.queued), Time: time.Now()},
+	}
+
+	c.pendingMux.Lock()
+	state.pending = make([]pendingItem, 0, len(c.checkpoints.pending))
+	for _, p := range c.checkpoints.pending {
+		state.pending = append(state.pending, p)
+	}
+	c.pendingMux.Unlock()
+	sort.Slice(state.pending, func(i, j int) bool { return state.pending[i].seq < state.pending[j].seq })
+
+	var err error
+	switch s := c.seen.(type) {
+	case seen.Enumerable:
+		s.Range(func(url string) bool {
+			state.seen = append(state.seen, url)
+			return true
+		})
+	case encoding.BinaryMarshaler:
+		state.seenFilter, err = s.MarshalBinary()
+	default:
+		err = fmt.Errorf("the seen URLs can't be saved")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state.sitemap, err = c.sitemap.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// write encodes the state of the crawl, one record per line
+func (s *checkpointState) write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(checkpointRecord{Header: &s.header}); err != nil {
+		return err
+	}
+	for i := range s.pending {
+		if err := enc.Encode(checkpointRecord{Item: &s.pending[i].item}); err != nil {
+			return err
+		}
+	}
+	for _, url := range s.seen {
+		if err := enc.Encode(checkpointRecord{Seen: url}); err != nil {
+			return err
+		}
+	}
+	if s.seenFilter != nil {
+		if err := enc.Encode(checkpointRecord{SeenFilter: s.seenFilter}); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	s.sitemap.RangeLinks(func(url string, links []sitemap.Link) bool {
+		err = enc.Encode(checkpointRecord{Links: &linksRecord{URL: url, Links: links}})
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	s.sitemap.RangePages(func(p sitemap.Page) bool {
+		err = enc.Encode(checkpointRecord{Page: &p})
+		return err == nil
+	})
+	return err
+}
+
+// Resume restores the state of a crawl of the same website from the checkpoint saved in dir, so that
+// Start continues it instead of starting from the entrypoint. The sitemap of the crawler must be empty,
+// unless it's a sitemap.Clearer: it's then cleared once the checkpoint is known to be of the same website.
+func (c *Crawler) Resume(dir string) error {
+	f, err := os.Open(filepath.Join(dir, checkpointFile))
+	if err != nil {
+		return fmt.Errorf("error opening the checkpoint: %s", err)
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+	var header *checkpointHeader
+	items := []frontier.Item{}
+	for {
+		var r checkpointRecord
+		err := dec.Decode(&r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading the checkpoint: %s", err)
+		}
+		switch {
+		case r.Header != nil:
+			if r.Header.Entrypoint != c.entrypoint {
+				return fmt.Errorf("the checkpoint is a crawl of %s, not %s", r.Header.Entrypoint, c.entrypoint)
+			}
+			// a sitemap reopened from disk may hold pages crawled after the checkpoint
+			if s, ok := c.sitemap.(sitemap.Clearer); ok {
+				if err := s.Clear(); err != nil {
+					return fmt.Errorf("error clearing the sitemap: %s", err)
+				}
+			}
+			header = r.Header
+		case header == nil:
+			return fmt.Errorf("error reading the checkpoint: missing header")
+		case r.Item != nil:
+			items = append(items, *r.Item)
+		case r.Seen != "":
+			c.addToSeen(r.Seen)
+		case r.SeenFilter != nil:
+			s, ok := c.seen.(encoding.BinaryUnmarshaler)
+			if !ok {
+				return fmt.Errorf("the checkpoint is of a crawl with a different set of seen URLs")
+			}
+			if err := s.UnmarshalBinary(r.SeenFilter); err != nil {
+				return err
+			}
+		case r.Links != nil:
+			c.sitemap.AddLinks(r.Links.URL, r.Links.Links)
+		case r.Page != nil:
+			page := *r.Page
+			c.sitemap.UpdatePage(page.URL, func(p *sitemap.Page) { *p = page })
+		}
+	}
+	if header == nil {
+		return fmt.Errorf("error reading the checkpoint: missing header")
+	}
+
+	atomic.StoreInt64(&c.queued, header.Queued)
+	for _, item := range items {
+		c.setCrawlDelay(item.URL)
+		if err := c.enqueue(item.URL, item.Depth); err != nil {
+			return fmt.Errorf("error queuing %s: %s", item.URL, err)
+		}
+	}
+	c.resumed = true
+	logrus.Infof("resuming the crawl of %s checkpointed at %s, %d urls pending", c.entrypoint, header.Time.Format(time.RFC3339), len(items))
+	return nil
+}
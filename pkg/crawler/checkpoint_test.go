@@ -0,0 +1,296 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amartorelli/millipedes/pkg/crawler/fetcher"
+	"github.com/amartorelli/millipedes/pkg/crawler/seen"
+	"github.com/amartorelli/millipedes/pkg/crawler/sitemap"
+)
+
+// countingFetcher wraps a fetcher and counts the requests sent for each URL
+type countingFetcher struct {
+	fetcher fetcher.Fetcher
+	counts  map[string]int
+	mux     *sync.Mutex
+}
+
+func newCountingFetcher(f fetcher.Fetcher) *countingFetcher {
+	return &countingFetcher{fetcher: f, counts: make(map[string]int), mux: &sync.Mutex{}}
+}
+
+func (f *countingFetcher) Fetch(url string) (*fetcher.Response, error) {
+	f.mux.Lock()
+	f.counts[url]++
+	f.mux.Unlock()
+	return f.fetcher.Fetch(url)
+}
+
+// treeWebsite returns a website where each page links to the two pages below it, down to the given depth
+func treeWebsite(depth int) map[string][]byte {
+	pages := make(map[string][]byte)
+	var add func(path string, d int)
+	add = func(path string, d int) {
+		links := ""
+		if d < depth {
+			links = fmt.Sprintf("<a href='%s/a'></a><a href='%s/b'></a><a href='https://example.com'></a>", path, path)
+			add(path+"/a", d+1)
+			add(path+"/b", d+1)
+		}
+		pages["https://example.com"+path] = []byte(fmt.Sprintf(template, links))
+	}
+	add("", 0)
+	return pages
+}
+
+// crawl runs a crawl until it's finished, resuming it from dir if not empty
+func crawl(t *testing.T, f fetcher.Fetcher, sm sitemap.Sitemap, resume string, opts ...Option) {
+	c, err := NewCrawler("https://example.com", 2, 10, 1, f, sm, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resume != "" {
+		if err := c.Resume(resume); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Start()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Wait(ctx); err != nil {
+		t.Fatalf("expecting the crawl to finish, got %s", err)
+	}
+	c.Shutdown()
+}
+
+// comparablePages returns the pages of a sitemap without the latency of their responses
+func comparablePages(sm sitemap.Sitemap) map[string]sitemap.Page {
+	pages := sm.GetPages()
+	for url, p := range pages {
+		if p.Response != nil {
+			r := *p.Response
+			r.Latency = 0
+			p.Response = &r
+		}
+		pages[url] = p
+	}
+	return pages
+}
+
+func TestCheckpointResume(t *testing.T) {
+	sets := map[string]func() seen.Set{
+		"sharded": func() seen.Set { return seen.NewShardedSet(seen.DefaultShards) },
+		"bloom": func() seen.Set {
+			s, _ := seen.NewBloomSet(10, seen.DefaultFalsePositiveRate)
+			return s
+		},
+	}
+	for name, newSet := range sets {
+		t.Run(name, func(t *testing.T) {
+			testCheckpointResume(t, newSet)
+		})
+	}
+}
+
+// testCheckpointResume interrupts a crawl and resumes it, with the given set of seen URLs
+func testCheckpointResume(t *testing.T, newSet func() seen.Set) {
+	website := treeWebsite(4)
+	expected := sitemap.NewMemorySitemap()
+	crawl(t, fetcher.NewMockFetcher(website), expected, "")
+
+	dir, err := ioutil.TempDir("", "millipedes-checkpoint-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// interrupt the crawl while a page in the middle of the website is being fetched
+	counter := newCountingFetcher(fetcher.NewMockFetcher(website))
+	gated := &gatedFetcher{
+		fetcher:  counter,
+		gateURL:  "https://example.com/a/b",
+		fetching: make(chan struct{}),
+		gate:     make(chan struct{}),
+	}
+	c, err := NewCrawler("https://example.com", 2, 10, 1, gated, sitemap.NewMemorySitemap(), WithCheckpoints(dir, time.Millisecond), WithSeenSet(newSet()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Start()
+	<-gated.fetching
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(gated.gate)
+	}()
+	c.Shutdown()
+	if c.IsDone() && len(counter.counts) == len(website) {
+		t.Fatal("expecting the crawl to be interrupted before fetching every page")
+	}
+
+	sm := sitemap.NewMemorySitemap()
+	crawl(t, counter, sm, dir, WithCheckpoints(dir, time.Hour), WithSeenSet(newSet()))
+	for url, n := range counter.counts {
+		if n != 1 {
+			t.Errorf("expecting %s to be fetched once, got %d", url, n)
+		}
+	}
+	if len(counter.counts) != len(website) {
+		t.Errorf("expecting the %d pages to be fetched, got %d", len(website), len(counter.counts))
+	}
+	if !reflect.DeepEqual(sm.GetLinks(), expected.GetLinks()) {
+		t.Errorf("expecting the resumed sitemap to be %v, got %v", expected.GetLinks(), sm.GetLinks())
+	}
+	if !reflect.DeepEqual(comparablePages(sm), comparablePages(expected)) {
+		t.Errorf("expecting the resumed pages to be %v, got %v", comparablePages(expected), comparablePages(sm))
+	}
+
+	// resuming a finished crawl doesn't fetch anything
+	crawl(t, counter, sitemap.NewMemorySitemap(), dir, WithSeenSet(newSet()))
+	if len(counter.counts) != len(website) {
+		t.Errorf("expecting no page to be fetched resuming a finished crawl, got %v", counter.counts)
+	}
+}
+
+func TestResumeOtherWebsite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "millipedes-checkpoint-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	crawl(t, fetcher.NewMockFetcher(fakeWebsites), sitemap.NewMemorySitemap(), "", WithCheckpoints(dir, 0))
+
+	c, err := NewCrawler("https://example.org", 1, 10, 1, fetcher.NewMockFetcher(fakeWebsites), sitemap.NewMemorySitemap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Resume(dir); err == nil {
+		t.Error("expecting resuming the crawl of another website to fail")
+	}
+}
+
+func TestResumeDiskSitemap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "millipedes-checkpoint-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	expected := sitemap.NewMemorySitemap()
+	crawl(t, fetcher.NewMockFetcher(fakeWebsites), expected, "", WithCheckpoints(dir, 0))
+
+	// the database reopened holds a page crawled after the checkpoint
+	disk, err := sitemap.NewDiskSitemap(filepath.Join(dir, "sitemap.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disk.Close()
+	disk.AddChildren("https://example.com/stale", nil)
+
+	c, err := NewCrawler("https://example.org", 1, 10, 1, fetcher.NewMockFetcher(fakeWebsites), disk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Resume(dir); err == nil || !disk.IsURLPresent("https://example.com/stale") {
+		t.Fatalf("expecting resuming the crawl of another website to fail and keep the sitemap, got %v", err)
+	}
+
+	crawl(t, fetcher.NewMockFetcher(fakeWebsites), disk, dir)
+	if !reflect.DeepEqual(disk.GetLinks(), expected.GetLinks()) {
+		t.Errorf("expecting the sitemap to be replaced by the checkpoint, got %v", disk.GetLinks())
+	}
+}
+
+// cancelledFetcher wraps a fetcher and waits for the context to be done when fetching gateURL,
+// like a request waiting to be retried
+type cancelledFetcher struct {
+	fetcher  fetcher.Fetcher
+	gateURL  string
+	fetching chan struct{}
+}
+
+func (f *cancelledFetcher) Fetch(url string) (*fetcher.Response, error) {
+	return f.fetcher.Fetch(url)
+}
+
+func (f *cancelledFetcher) FetchContext(ctx context.Context, url string) (*fetcher.Response, error) {
+	if url == f.gateURL {
+		close(f.fetching)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return f.fetcher.Fetch(url)
+}
+
+func TestResumeInterruptedFetch(t *testing.T) {
+	website := treeWebsite(2)
+	expected := sitemap.NewMemorySitemap()
+	crawl(t, fetcher.NewMockFetcher(website), expected, "")
+
+	dir, err := ioutil.TempDir("", "millipedes-checkpoint-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cancelled := &cancelledFetcher{
+		fetcher:  fetcher.NewMockFetcher(website),
+		gateURL:  "https://example.com/a",
+		fetching: make(chan struct{}),
+	}
+	sm := sitemap.NewMemorySitemap()
+	c, err := NewCrawler("https://example.com", 2, 10, 1, cancelled, sm, WithCheckpoints(dir, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Start()
+	<-cancelled.fetching
+	c.Shutdown()
+	if sm.IsURLPresent("https://example.com/a") {
+		t.Fatal("expecting the interrupted fetch not to be recorded as a failure")
+	}
+
+	// the interrupted page is still pending and fetched on resume
+	counter := newCountingFetcher(fetcher.NewMockFetcher(website))
+	sm = sitemap.NewMemorySitemap()
+	crawl(t, counter, sm, dir)
+	if counter.counts["https://example.com/a"] != 1 {
+		t.Errorf("expecting the interrupted page to be fetched once on resume, got %d", counter.counts["https://example.com/a"])
+	}
+	if !reflect.DeepEqual(sm.GetLinks(), expected.GetLinks()) {
+		t.Errorf("expecting the resumed sitemap to be %v, got %v", expected.GetLinks(), sm.GetLinks())
+	}
+}
+
+func TestResumeCrawlDelay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "millipedes-checkpoint-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	checkpoint := `{"header":{"entrypoint":"https://example.com","queued":2,"time":"2020-01-01T00:00:00Z"}}
+{"item":{"url":"https://example.com/1","depth":1}}
+{"item":{"url":"https://example.com/2","depth":1}}
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, checkpointFile), []byte(checkpoint), 0644); err != nil {
+		t.Fatal(err)
+	}
+	website := map[string][]byte{
+		"https://example.com/robots.txt": []byte("User-agent: *\nCrawl-delay: 0.2\n"),
+		"https://example.com/1":          []byte(nolinks),
+		"https://example.com/2":          []byte(nolinks),
+	}
+
+	// the pending URLs are queued again with the Crawl-delay of their host
+	start := time.Now()
+	crawl(t, fetcher.NewMockFetcher(website), sitemap.NewMemorySitemap(), dir, WithRobots("millipedes"))
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Errorf("expecting the resumed requests to wait for the Crawl-delay, took %s", elapsed)
+	}
+}
@@ -2,83 +2,251 @@ package crawler
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"net/http"
 	"net/url"
-	"regexp"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/amartorelli/millipedes/pkg/crawler/fetcher"
+	"github.com/amartorelli/millipedes/pkg/crawler/filter"
+	"github.com/amartorelli/millipedes/pkg/crawler/frontier"
+	"github.com/amartorelli/millipedes/pkg/crawler/normalizer"
 	"github.com/amartorelli/millipedes/pkg/crawler/parser"
+	"github.com/amartorelli/millipedes/pkg/crawler/robots"
+	"github.com/amartorelli/millipedes/pkg/crawler/scheduler"
+	"github.com/amartorelli/millipedes/pkg/crawler/seen"
 	"github.com/amartorelli/millipedes/pkg/crawler/sitemap"
 	"github.com/sirupsen/logrus"
 )
 
+// DefaultFollow are the kinds of links crawled by default: the ones leading to other pages.
+// Resources such as images, scripts and stylesheets, and forms, are only recorded.
+var DefaultFollow = []parser.Kind{parser.KindAnchor, parser.KindArea, parser.KindIframe, parser.KindMetaRefresh,
+	parser.KindAlternate, parser.KindCanonical, parser.KindNext, parser.KindPrev}
+
+// errInterrupted is returned when fetching a page was cut short by Shutdown
+var errInterrupted = errors.New("fetch interrupted by the shutdown")
+
+// defaultBackoff is how long a host isn't fetched after a 429 or 503 response without Retry-After
+const defaultBackoff = 10 * time.Second
+
 // Crawler represents the crawler
 type Crawler struct {
 	entrypoint  string
 	domain      string
-	domainRE    *regexp.Regexp
+	scope       *scope
+	scopePolicy ScopePolicy
 	fetcher     fetcher.Fetcher
-	ratelimiter <-chan time.Time
+	interval    time.Duration
 	sitemap     sitemap.Sitemap
-	queue       chan string
-	queueLen    int
-	seenURL     map[string]struct{}
-	seenURLMux  *sync.RWMutex
-	mustStop    bool
+	frontier    frontier.Frontier
+	scheduler   *scheduler.Scheduler
+	burst       int
+	hostConns   int
+	pending     int64
+	done        chan struct{}
+	doneOnce    *sync.Once
+	seen        seen.Set
 	wg          *sync.WaitGroup
 	workers     int
 	ctx         context.Context
 	cancel      context.CancelFunc
+	runCtx      context.Context
+	runCancel   context.CancelFunc
+	robots      *robots.Cache
+	limits      Limits
+	filter      *filter.Filter
+	normalizer  *normalizer.Normalizer
+	parser      *parser.Parser
+	follow      map[parser.Kind]bool
+	nofollow    bool
+	userAgent   string
+	queued      int64
+	timer       *time.Timer
+	checkpoints *checkpoints
+	pendingMux  *sync.Mutex
+	processMux  *sync.RWMutex
+	resumed     bool
+	// stopped is set when the crawl is stopped before being done
+	stopped int32
+}
+
+// Limits bounds the crawl. A zero value means no limit.
+type Limits struct {
+	// MaxDepth is the maximum number of links followed from the entrypoint
+	MaxDepth int
+	// MaxPages is the maximum number of pages crawled
+	MaxPages int
+	// MaxDuration is the maximum time spent crawling, pages being processed are completed
+	MaxDuration time.Duration
+}
+
+// Option configures an optional behaviour of the crawler
+type Option func(c *Crawler)
+
+// WithRobots makes the crawler honor the robots.txt rules and Crawl-delay for the given user agent
+func WithRobots(userAgent string) Option {
+	return func(c *Crawler) {
+		c.robots = robots.NewCache(c.fetcher, userAgent)
+	}
+}
+
+// WithFrontier replaces the default frontier, which spills to disk once it holds more than queueLen URLs
+func WithFrontier(f frontier.Frontier) Option {
+	return func(c *Crawler) {
+		c.frontier = f
+	}
+}
+
+// WithSeenSet replaces the default set of seen URLs, an exact in-memory set, e.g. with an approximate
+// one for crawls whose URLs don't fit in memory
+func WithSeenSet(s seen.Set) Option {
+	return func(c *Crawler) {
+		c.seen = s
+	}
+}
+
+// WithLimits stops the crawl after a given depth, number of pages or duration
+func WithLimits(l Limits) Option {
+	return func(c *Crawler) {
+		c.limits = l
+	}
+}
+
+// WithFilter only queues the links allowed by the include and exclude rules of the filter.
+// The entrypoint is always crawled.
+func WithFilter(f *filter.Filter) Option {
+	return func(c *Crawler) {
+		c.filter = f
+	}
+}
+
+// WithScope sets the policy deciding which hosts, schemes and ports belong to the crawl
+func WithScope(p ScopePolicy) Option {
+	return func(c *Crawler) {
+		c.scopePolicy = p
+	}
+}
+
+// WithNormalizer canonicalizes the entrypoint and the extracted links so that equivalent URLs are crawled only once
+func WithNormalizer(n *normalizer.Normalizer) Option {
+	return func(c *Crawler) {
+		c.normalizer = n
+	}
+}
+
+// WithFollow sets the kinds of links which are crawled, the other ones are only recorded as edges
+// of the sitemap. By default DefaultFollow is used.
+func WithFollow(kinds ...parser.Kind) Option {
+	return func(c *Crawler) {
+		c.follow = make(map[parser.Kind]bool, len(kinds))
+		for _, k := range kinds {
+			c.follow[k] = true
+		}
+	}
+}
+
+// WithFollowNofollow crawls the links marked as nofollow, either with rel="nofollow" or
+// by the robots directives of their page, which are otherwise only recorded
+func WithFollowNofollow() Option {
+	return func(c *Crawler) {
+		c.nofollow = true
+	}
 }
 
-// NewCrawler returns a new crawler
-func NewCrawler(website string, workers, queueLen, fetchIntervalMs int, fetcher fetcher.Fetcher, sitemap sitemap.Sitemap) (*Crawler, error) {
+// WithUserAgent sets the user agent the X-Robots-Tag directives are evaluated for,
+// directives for other user agents are ignored
+func WithUserAgent(userAgent string) Option {
+	return func(c *Crawler) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithHostLimits sets the number of requests a host can receive in a burst and the maximum number
+// of concurrent requests to a host, 0 meaning no limit. By default requests aren't sent in bursts.
+func WithHostLimits(burst, maxConcurrency int) Option {
+	return func(c *Crawler) {
+		c.burst = burst
+		c.hostConns = maxConcurrency
+	}
+}
+
+// NewCrawler returns a new crawler. queueLen is the number of pending URLs kept in memory
+// and each host is fetched at most once every fetchIntervalMs.
+func NewCrawler(website string, workers, queueLen, fetchIntervalMs int, fetcher fetcher.Fetcher, sitemap sitemap.Sitemap, opts ...Option) (*Crawler, error) {
 	u, err := url.Parse(website)
 	if err != nil {
 		return nil, err
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
+	runCtx, runCancel := context.WithCancel(ctx)
 
-	return &Crawler{
-		entrypoint:  website,
-		domain:      u.Host,
-		domainRE:    regexp.MustCompile(fmt.Sprintf(".*%s$", u.Host)),
-		fetcher:     fetcher,
-		ratelimiter: time.Tick(time.Duration(fetchIntervalMs) * time.Millisecond),
-		sitemap:     sitemap,
-		seenURL:     make(map[string]struct{}, 0),
-		seenURLMux:  &sync.RWMutex{},
-		queue:       make(chan string, queueLen),
-		queueLen:    0,
-		mustStop:    false,
-		wg:          &sync.WaitGroup{},
-		workers:     workers,
-		ctx:         ctx,
-		cancel:      cancel,
-	}, nil
+	c := &Crawler{
+		entrypoint: website,
+		domain:     u.Host,
+		fetcher:    fetcher,
+		interval:   time.Duration(fetchIntervalMs) * time.Millisecond,
+		sitemap:    sitemap,
+		seen:       seen.NewShardedSet(seen.DefaultShards),
+		frontier:   frontier.NewSpillFrontier(queueLen, ""),
+		burst:      1,
+		pending:    0,
+		done:       make(chan struct{}),
+		doneOnce:   &sync.Once{},
+		wg:         &sync.WaitGroup{},
+		workers:    workers,
+		ctx:        ctx,
+		cancel:     cancel,
+		runCtx:     runCtx,
+		runCancel:  runCancel,
+		pendingMux: &sync.Mutex{},
+		processMux: &sync.RWMutex{},
+	}
+	WithFollow(DefaultFollow...)(c)
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.scope, err = newScope(u, c.scopePolicy)
+	if err != nil {
+		return nil, err
+	}
+	if c.normalizer != nil {
+		c.entrypoint, err = c.normalizer.Normalize(c.entrypoint)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.parser = parser.NewParser(c.normalizer)
+	c.scheduler = scheduler.New(c.frontier, c.interval, c.burst, c.hostConns, 2*workers)
+	return c, nil
 }
 
 // isURLSeen checks if a URL has been seen already
 func (c *Crawler) isURLSeen(url string) bool {
-	c.seenURLMux.RLock()
-	_, ok := c.seenURL[url]
-	c.seenURLMux.RUnlock()
-	return ok
+	return c.seen.Contains(url)
 }
 
-// addToSeen sets a URL as seen so that the program won't try to crawl the link again
-func (c *Crawler) addToSeen(url string) {
-	c.seenURLMux.Lock()
-	c.seenURL[url] = struct{}{}
-	c.seenURLMux.Unlock()
+// addToSeen sets a URL as seen so that the program won't try to crawl the link again, and returns false
+// if it had been seen already. It's a single test-and-set, so that concurrent workers can't both claim a URL.
+func (c *Crawler) addToSeen(url string) bool {
+	return c.seen.Add(url)
+}
+
+// forgetSeen unmarks a URL set as seen which couldn't be queued, so that it's queued if found again.
+// The sets which can't remove URLs, e.g. Bloom filters, keep it.
+func (c *Crawler) forgetSeen(url string) {
+	if s, ok := c.seen.(seen.Remover); ok {
+		s.Remove(url)
+	}
 }
 
-// processURL parses a page and queues links after having filtered them
-func (c *Crawler) processURL(url string) error {
-	logrus.Debugf("processing %s", url)
+// processURL parses a page found at the given depth and queues links after having filtered them
+func (c *Crawler) processURL(url string, depth int) error {
+	logrus.Debugf("processing %s (depth %d)", url, depth)
 
 	// if present skip
 	if c.sitemap.IsURLPresent(url) {
@@ -87,70 +255,401 @@ func (c *Crawler) processURL(url string) error {
 	}
 
 	// get website
-	page, err := c.fetcher.Fetch(url)
+	resp, err := c.fetch(url)
 	if err != nil {
+		// the page wasn't fetched, rather than failed, and is fetched again on resume
+		if c.ctx.Err() != nil {
+			return errInterrupted
+		}
+		c.backoff(url, err)
+		c.recordFailure(url, depth, err)
 		return err
 	}
 
-	c.addToSeen(url)
+	// redirects are edges of the sitemap and the page is stored under its final URL
+	if len(resp.Redirects) > 0 {
+		final, claimed := c.addRedirects(url, depth, resp.Redirects)
+		if final != url && !claimed {
+			logrus.Debugf("%s redirects to %s, already seen", url, final)
+			return nil
+		}
+		url = final
+	}
+
+	directives := robots.ParseHeader(resp.Header.Values("X-Robots-Tag"), c.userAgent)
+	c.sitemap.UpdatePage(url, func(p *sitemap.Page) {
+		p.Depth = depth
+		p.Resource = sitemap.ResourceType(fetcher.MediaType(resp.ContentType))
+		p.Status = resp.StatusCode
+		p.Response = pageResponse(resp)
+		p.NoIndex = directives.NoIndex
+		p.NoFollow = directives.NoFollow
+	})
 
-	// extract links and set connections for the analysed url
-	if !c.mustStop {
-		links := parser.ExtractLinks(page, c.entrypoint)
-		c.sitemap.AddChildren(url, links)
+	// other resources, e.g. images or PDFs, are leaves of the sitemap, as are pages
+	// outside of the scope of the crawl reached through a redirect
+	if !resp.IsHTML() || !c.isSameDomain(url) {
+		logrus.Debugf("%s is %s, not parsing it", url, resp.ContentType)
+		c.sitemap.AddChildren(url, nil)
+		return nil
+	}
+
+	// extract links and set connections for the analysed url, unless shutting down
+	if !c.interrupted() {
+		doc := c.parser.ParseResponse(resp.Body, resp.FinalURL, resp.Header.Get("Content-Type"))
+		directives = directives.Merge(doc.Robots)
+		c.sitemap.UpdatePage(url, func(p *sitemap.Page) {
+			for _, l := range doc.NonNavigable {
+				p.NonNavigable = append(p.NonNavigable, toSitemapLink(l))
+			}
+			p.Warnings = doc.Warnings
+			p.Metadata = toSitemapMetadata(doc.Metadata)
+			p.Metadata.Charset = doc.Charset
+			p.NoIndex = directives.NoIndex
+			p.NoFollow = directives.NoFollow
+		})
+
+		edges := make([]sitemap.Link, 0, len(doc.Links))
+		followed := []string{}
+		for _, l := range doc.Links {
+			nofollow := l.Nofollow || directives.NoFollow
+			edge := toSitemapLink(l)
+			edge.Nofollow = nofollow
+			edges = append(edges, edge)
+			if c.follow[l.Kind] && (!nofollow || c.nofollow) {
+				followed = append(followed, l.URL)
+			}
+		}
+		c.sitemap.AddLinks(url, edges)
 
 		// add links to queue
-		c.queueFilteredLinks(links)
+		c.queueFilteredLinks(followed, depth+1)
 	}
 	return nil
 }
 
-// isSameDomain checks if the URL belongs to the same domain as the entry point
+// fetch fetches a url, without waiting to retry it once the crawler is stopped
+func (c *Crawler) fetch(url string) (*fetcher.Response, error) {
+	if f, ok := c.fetcher.(fetcher.ContextFetcher); ok {
+		return f.FetchContext(c.ctx, url)
+	}
+	return c.fetcher.Fetch(url)
+}
+
+// isSameDomain checks if the URL belongs to the scope of the crawl, by default the
+// same domain as the entry point or one of its subdomains
 func (c *Crawler) isSameDomain(uri string) bool {
 	URL, err := url.Parse(uri)
 	if err != nil {
 		return false
 	}
-	return c.domainRE.MatchString(URL.Host)
+	return c.scope.contains(URL)
+}
+
+// setCrawlDelay makes the scheduler honor the Crawl-delay set by robots.txt for the host of the URL
+func (c *Crawler) setCrawlDelay(uri string) {
+	if c.robots == nil {
+		return
+	}
+	if delay := c.robots.CrawlDelay(uri); delay > 0 {
+		if u, err := url.Parse(uri); err == nil {
+			c.scheduler.SetCrawlDelay(u.Host, delay)
+		}
+	}
+}
+
+// isAllowed checks if robots.txt allows the URL to be crawled. Disallowed URLs are
+// recorded in the sitemap so that they don't silently disappear.
+func (c *Crawler) isAllowed(uri string, depth int) bool {
+	if c.robots == nil {
+		return true
+	}
+	if c.robots.Allowed(uri) {
+		c.setCrawlDelay(uri)
+		return true
+	}
+	logrus.Debugf("%s blocked by robots.txt", uri)
+	c.sitemap.UpdatePage(uri, func(p *sitemap.Page) {
+		p.Skipped = sitemap.ReasonRobots
+		p.Depth = depth
+	})
+	return false
+}
+
+// isIncluded checks if the URL passes the user-supplied filter. Filtered URLs are recorded in the
+// sitemap as leaf nodes so that the graph stays complete.
+func (c *Crawler) isIncluded(uri string, depth int) bool {
+	if c.filter == nil || c.filter.Allowed(uri) {
+		return true
+	}
+	logrus.Debugf("%s filtered", uri)
+	c.sitemap.UpdatePage(uri, func(p *sitemap.Page) {
+		p.Skipped = sitemap.ReasonFiltered
+		p.Depth = depth
+	})
+	return false
+}
+
+// backoff stops fetching from a host that replied 429 Too Many Requests or 503 Service Unavailable,
+// for as long as requested with Retry-After
+func (c *Crawler) backoff(uri string, err error) {
+	se, ok := err.(*fetcher.Error)
+	if !ok || se.Kind != fetcher.KindStatus || (se.StatusCode != http.StatusTooManyRequests && se.StatusCode != http.StatusServiceUnavailable) {
+		return
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return
+	}
+	delay := se.RetryAfter
+	if delay <= 0 {
+		delay = defaultBackoff
+	}
+	logrus.Warnf("%s replied %d, backing off for %s", u.Host, se.StatusCode, delay)
+	c.scheduler.Backoff(u.Host, delay)
+}
+
+// pageResponse converts the response of a fetcher into the metadata stored in the sitemap
+func pageResponse(resp *fetcher.Response) *sitemap.Response {
+	r := &sitemap.Response{
+		Status:      resp.StatusCode,
+		FinalURL:    resp.FinalURL,
+		Header:      resp.Header,
+		ContentType: resp.ContentType,
+		Size:        resp.Size,
+		Latency:     resp.Latency,
+		DNS:         resp.Timings.DNS,
+		Connect:     resp.Timings.Connect,
+		TLS:         resp.Timings.TLS,
+		TTFB:        resp.Timings.TTFB,
+	}
+	for _, redirect := range resp.Redirects {
+		r.Redirects = append(r.Redirects, sitemap.Redirect{URL: redirect.URL, To: redirect.To, Status: redirect.StatusCode})
+	}
+	return r
+}
+
+// canonical returns the canonical form of a URL if a normalizer is set
+func (c *Crawler) canonical(uri string) string {
+	if c.normalizer == nil {
+		return uri
+	}
+	canonical, err := c.normalizer.Normalize(uri)
+	if err != nil {
+		return uri
+	}
+	return canonical
+}
+
+// addRedirects stores the redirects followed fetching a URL as edges of the sitemap,
+// marking every hop as seen, and returns the final URL and false if it had been seen already
+func (c *Crawler) addRedirects(url string, depth int, redirects []fetcher.Redirect) (string, bool) {
+	final, claimed := url, false
+	for i, r := range redirects {
+		from := c.canonical(r.URL)
+		if i == 0 {
+			from = url
+		}
+		final = c.canonical(r.To)
+		claimed = c.addToSeen(final)
+		status := r.StatusCode
+		c.sitemap.UpdatePage(from, func(p *sitemap.Page) {
+			p.Depth = depth
+			p.Status = status
+		})
+		c.sitemap.AddLinks(from, []sitemap.Link{{URL: final, Redirect: r.StatusCode}})
+	}
+	return final, claimed
+}
+
+// failure returns the update storing the final error of a page that couldn't be fetched
+func failure(depth int, err error) func(p *sitemap.Page) {
+	attempts := 1
+	fe, ok := err.(*fetcher.Error)
+	if ok && fe.Attempts > 0 {
+		attempts = fe.Attempts
+	}
+	return func(p *sitemap.Page) {
+		p.Depth = depth
+		p.Error = err.Error()
+		p.ErrorKind = string(fetcher.KindOf(err))
+		p.Attempts = attempts
+		if ok && fe.StatusCode != 0 {
+			p.Status = fe.StatusCode
+		}
+	}
+}
+
+// recordFailure stores in the sitemap a page that couldn't be fetched, with its final error
+func (c *Crawler) recordFailure(url string, depth int, err error) {
+	fe, ok := err.(*fetcher.Error)
+	fail := failure(depth, err)
+	if ok && len(fe.Redirects) > 0 {
+		// keep the redirects followed before failing, e.g. a loop
+		final, claimed := c.addRedirects(url, depth, fe.Redirects)
+		if fe.Kind == fetcher.KindRedirect {
+			c.sitemap.UpdatePage(url, fail)
+			return
+		}
+		// otherwise the error is the outcome of the last URL of the chain, e.g. a redirect to a 404,
+		// unless the URL has been claimed by another page
+		if !claimed {
+			return
+		}
+		url = final
+	}
+	c.sitemap.UpdatePage(url, fail)
+	c.sitemap.AddChildren(url, nil)
+}
+
+// reserveBudget accounts for a new page to crawl and returns false if the page budget is exhausted
+func (c *Crawler) reserveBudget() bool {
+	if c.limits.MaxPages <= 0 {
+		return true
+	}
+	if atomic.AddInt64(&c.queued, 1) > int64(c.limits.MaxPages) {
+		atomic.AddInt64(&c.queued, -1)
+		return false
+	}
+	return true
+}
+
+// releaseBudget gives back a page reserved with reserveBudget that couldn't be queued
+func (c *Crawler) releaseBudget() {
+	if c.limits.MaxPages > 0 {
+		atomic.AddInt64(&c.queued, -1)
+	}
 }
 
-// queueFilteredLinks adds links to the queue after having filtered them. Links must belong to
-// the same main domain and they will only be added to the queue if they were never processed before.
-func (c *Crawler) queueFilteredLinks(links []string) {
+// queueFilteredLinks adds links found at the given depth to the queue after having filtered them.
+// Links must belong to the same main domain, pass the filter, be allowed by robots.txt, be within the crawl limits
+// and they will only be added to the queue if they were never processed before.
+func (c *Crawler) queueFilteredLinks(links []string, depth int) {
+	if c.limits.MaxDepth > 0 && depth > c.limits.MaxDepth {
+		return
+	}
 	for _, l := range links {
 		if !c.isSameDomain(l) {
 			continue
 		}
-		if !c.isURLSeen(l) {
-			select {
-			case c.queue <- l:
-				c.queueLen++
-				logrus.Debugf("queuing %s", l)
-				c.addToSeen(l)
-			case <-c.ctx.Done():
-				logrus.Infof("cancelling %s", l)
-				return
-			}
+		if !c.addToSeen(l) {
+			continue
+		}
+		if !c.isIncluded(l, depth) || !c.isAllowed(l, depth) {
+			continue
 		}
+		if c.interrupted() {
+			logrus.Infof("cancelling %s", l)
+			c.forgetSeen(l)
+			return
+		}
+		if !c.reserveBudget() {
+			logrus.Debugf("page budget exhausted, not queuing %s", l)
+			c.forgetSeen(l)
+			return
+		}
+		err := c.enqueue(l, depth)
+		if err != nil {
+			c.releaseBudget()
+			c.forgetSeen(l)
+			logrus.Errorf("error queuing %s: %s", l, err)
+			continue
+		}
+		logrus.Debugf("queuing %s", l)
 	}
 }
 
-// crawlQueue iterates over the elements in the queue and processes the URLs
+// interrupted returns true if the crawl is shutting down and the page being processed can be left
+// incomplete. With checkpoints pages are always completed, so that the state saved is consistent.
+func (c *Crawler) interrupted() bool {
+	return c.ctx.Err() != nil && c.checkpoints == nil
+}
+
+// enqueue pushes a URL to the frontier and accounts for it as pending work
+func (c *Crawler) enqueue(url string, depth int) error {
+	atomic.AddInt64(&c.pending, 1)
+	item := frontier.Item{URL: url, Depth: depth}
+	c.trackPending(item)
+	err := c.scheduler.Push(item)
+	if err != nil {
+		c.untrackPending(url)
+		c.taskDone()
+		return err
+	}
+	return nil
+}
+
+// taskDone marks a queued URL as fully processed, links included. When no work
+// is left, neither queued nor in progress, the crawl is done.
+func (c *Crawler) taskDone() {
+	if atomic.AddInt64(&c.pending, -1) == 0 {
+		c.finish()
+	}
+}
+
+// finish marks the crawl as done and stops the idle workers
+func (c *Crawler) finish() {
+	c.doneOnce.Do(func() { close(c.done) })
+	c.runCancel()
+}
+
+// crawlQueue processes the URLs handed out by the scheduler until the crawl is done or shut down
 func (c *Crawler) crawlQueue() {
-	for l := range c.queue {
-		<-c.ratelimiter
-		c.queueLen--
-		err := c.processURL(l)
+	defer c.wg.Done()
+	for {
+		item, release, err := c.scheduler.Next(c.runCtx)
 		if err != nil {
+			if c.runCtx.Err() == nil {
+				logrus.Errorf("error reading the frontier: %s", err)
+			}
+			return
+		}
+
+		// checkpoints wait for the pages being processed
+		c.processMux.RLock()
+		err = c.processURL(item.URL, item.Depth)
+		release()
+		if err != nil && err != errInterrupted {
 			logrus.Error(err)
 		}
+		// an interrupted URL stays pending, so that the checkpoint queues it again
+		if err != errInterrupted {
+			c.untrackPending(item.URL)
+		}
+		c.taskDone()
+		c.processMux.RUnlock()
 	}
-	c.wg.Done()
 }
 
-// IsDone returns true if the queue is empty so that the crawler can stop
+// IsDone returns true if there are no URLs left to crawl, neither queued nor in progress
 func (c *Crawler) IsDone() bool {
-	return c.queueLen == 0
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Complete returns true if the crawl is done because there were no URLs left to crawl, false if it's
+// still going on or it was stopped before, e.g. by Shutdown or the maximum duration
+func (c *Crawler) Complete() bool {
+	return c.IsDone() && atomic.LoadInt32(&c.stopped) == 0
+}
+
+// Done returns a channel that is closed when the crawl is finished
+func (c *Crawler) Done() <-chan struct{} {
+	return c.done
+}
+
+// Wait blocks until the crawl is finished or the context is cancelled
+func (c *Crawler) Wait(ctx context.Context) error {
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // Start starts multiple concurrent workers
@@ -160,19 +659,111 @@ func (c *Crawler) Start() {
 		c.wg.Add(1)
 		go c.crawlQueue()
 	}
-	c.queue <- c.entrypoint
+	if c.limits.MaxDuration > 0 {
+		c.timer = time.AfterFunc(c.limits.MaxDuration, func() {
+			logrus.Infof("maximum crawl duration of %s reached, stopping", c.limits.MaxDuration)
+			c.stop()
+		})
+	}
+	if c.checkpoints != nil {
+		c.checkpoints.running = true
+		go c.runCheckpoints()
+	}
+	if c.resumed {
+		if atomic.LoadInt64(&c.pending) == 0 {
+			logrus.Info("the checkpointed crawl was already finished")
+			c.finish()
+		}
+		return
+	}
+	if !c.isAllowed(c.entrypoint, 0) {
+		logrus.Warnf("%s is disallowed by robots.txt", c.entrypoint)
+		c.finish()
+		return
+	}
+	c.reserveBudget()
+	c.addToSeen(c.entrypoint)
+	err := c.enqueue(c.entrypoint, 0)
+	if err != nil {
+		logrus.Errorf("error queuing %s: %s", c.entrypoint, err)
+		c.finish()
+	}
 }
 
 // Sitemap returns a structure representing the sitemap
 func (c *Crawler) Sitemap() map[string][]string {
-	return c.sitemap.GetSitemap()
+	return c.Graph().Children()
 }
 
-// Shutdown triggers a stop of the workers
-func (c *Crawler) Shutdown() {
-	c.mustStop = true
+// Graph returns a snapshot of the sitemap, which can be taken while the crawl goes on
+func (c *Crawler) Graph() *sitemap.Graph {
+	return sitemap.NewGraph(c.sitemap)
+}
+
+// stop cancels the crawl, waits for the pages being processed and marks the crawl as done
+func (c *Crawler) stop() {
+	if !c.IsDone() {
+		atomic.StoreInt32(&c.stopped, 1)
+	}
 	c.cancel()
-	time.Sleep(5 * time.Second)
-	close(c.queue)
 	c.wg.Wait()
+	c.finish()
+}
+
+// Shutdown stops the workers, waiting for the pages being processed, and discards the frontier and
+// the seen URLs. With checkpoints the state of the crawl is saved first, so that it can be resumed.
+func (c *Crawler) Shutdown() {
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	if c.checkpoints != nil {
+		c.stopCheckpoints()
+	}
+	c.stop()
+	if c.checkpoints != nil {
+		if err := c.Checkpoint(); err != nil {
+			logrus.Error(err)
+		}
+	}
+	err := c.frontier.Close()
+	if err != nil {
+		logrus.Error(err)
+	}
+	if err := c.scheduler.Close(); err != nil {
+		logrus.Error(err)
+	}
+	if err := c.seen.Close(); err != nil {
+		logrus.Error(err)
+	}
+}
+
+// toSitemapLink converts a link found by the parser to an edge of the sitemap
+func toSitemapLink(l parser.Link) sitemap.Link {
+	return sitemap.Link{
+		URL:      l.URL,
+		Kind:     string(l.Kind),
+		Nofollow: l.Nofollow,
+		Text:     l.Text,
+		Title:    l.Title,
+		Rel:      l.Rel,
+		Position: string(l.Position),
+	}
+}
+
+// toSitemapMetadata converts the metadata found by the parser to the metadata of a page of the sitemap
+func toSitemapMetadata(m parser.Metadata) *sitemap.Metadata {
+	var headings []sitemap.Heading
+	for _, h := range m.Headings {
+		headings = append(headings, sitemap.Heading{Level: h.Level, Text: h.Text})
+	}
+	return &sitemap.Metadata{
+		Title:       m.Title,
+		Description: m.Description,
+		Headings:    headings,
+		Canonical:   m.Canonical,
+		Lang:        m.Lang,
+		OpenGraph:   m.OpenGraph,
+		Twitter:     m.Twitter,
+		WordCount:   m.WordCount,
+	}
 }
@@ -1,11 +1,20 @@
 package crawler
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/amartorelli/millipedes/pkg/crawler/fetcher"
+	"github.com/amartorelli/millipedes/pkg/crawler/filter"
+	"github.com/amartorelli/millipedes/pkg/crawler/frontier"
+	"github.com/amartorelli/millipedes/pkg/crawler/normalizer"
+	"github.com/amartorelli/millipedes/pkg/crawler/parser"
 	"github.com/amartorelli/millipedes/pkg/crawler/sitemap"
 )
 
@@ -52,37 +61,37 @@ func TestProcessURL(t *testing.T) {
 	}
 
 	// testing entry point, expecting two pages
-	err = c.processURL("https://example.com")
+	err = c.processURL("https://example.com", 0)
 	if err != nil {
 		t.Error(err)
 	}
-	if c.queueLen != 2 {
+	if c.frontier.Len() != 2 {
 		t.Errorf("expecting two pages in https://example.com")
 	}
 
 	// if we execute again we expect no more elements in the queue
-	err = c.processURL("https://example.com")
+	err = c.processURL("https://example.com", 0)
 	if err != nil {
 		t.Error(err)
 	}
-	if c.queueLen != 2 {
+	if c.frontier.Len() != 2 {
 		t.Errorf("expecting two pages in https://example.com because already analysed")
 	}
 
 	// if we fetch a page that doesn't exist we expect an error
-	err = c.processURL("https://example.com/nothere")
+	err = c.processURL("https://example.com/nothere", 0)
 	if err == nil {
 		t.Error("expecting https://example.com/nothere to be not found")
 	}
 
-	// if mustStop is set we shouldn't ad any more links to the queue
-	c.mustStop = true
-	err = c.processURL("https://example.com/map")
+	// if the crawler is shutting down we shouldn't ad any more links to the queue
+	c.cancel()
+	err = c.processURL("https://example.com/map", 0)
 	if err != nil {
 		t.Error(err)
 	}
-	if c.queueLen != 2 {
-		t.Errorf("expecting no more links in the queue because mustStop is set")
+	if c.frontier.Len() != 2 {
+		t.Errorf("expecting no more links in the queue because the crawler is shutting down")
 	}
 }
 
@@ -101,6 +110,8 @@ func TestIsSameDomain(t *testing.T) {
 		{"https://community.example.com/testpage", true},
 		{"https://google.com", false},
 		{"https://google.com/example.com", false},
+		{"https://notexample.com", false},
+		{"https://example.com.google.com", false},
 	}
 
 	for _, tc := range tt {
@@ -118,30 +129,52 @@ func TestQueueFilteredLinks(t *testing.T) {
 	}
 
 	// queuing nothing
-	c.queueFilteredLinks([]string{})
-	if c.queueLen > 0 {
+	c.queueFilteredLinks([]string{}, 1)
+	if c.frontier.Len() > 0 {
 		t.Errorf("expecting the queue length to be 0 because no links were queued")
 	}
 
 	// trying to queue a link that doesn't belong to the same domain
-	c.queueFilteredLinks([]string{"www.google.com/test"})
-	if c.queueLen > 0 {
+	c.queueFilteredLinks([]string{"www.google.com/test"}, 1)
+	if c.frontier.Len() > 0 {
 		t.Errorf("expecting the queue length to be 0 because the link doesn't belong to the same domain")
 	}
 
 	// trying to queue a link that doesn't belong to the same domain and one that does
-	c.queueFilteredLinks([]string{"www.google.com/test", "http://community.example.com/"})
-	if c.queueLen != 1 {
+	c.queueFilteredLinks([]string{"www.google.com/test", "http://community.example.com/"}, 1)
+	if c.frontier.Len() != 1 {
 		t.Errorf("expecting the queue length to be 1 because out of the two links pushed only one belongs to the same domain")
 	}
 
 	// trying to queue a link that has already been seen
-	c.queueFilteredLinks([]string{"http://community.example.com/"})
-	if c.queueLen != 1 {
+	c.queueFilteredLinks([]string{"http://community.example.com/"}, 1)
+	if c.frontier.Len() != 1 {
 		t.Errorf("expecting the queue length to be 1 because the link we pushed had already been seen before")
 	}
 }
 
+func TestQueueFilteredLinksConcurrent(t *testing.T) {
+	c, err := NewCrawler("https://example.com", 1, 10, 200, fetcher.NewMockFetcher(fakeWebsites), sitemap.NewMemorySitemap())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// workers finding the same links queue each of them once
+	links := []string{"https://example.com/a", "https://example.com/b", "https://example.com/c"}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.queueFilteredLinks(links, 1)
+		}()
+	}
+	wg.Wait()
+	if c.frontier.Len() != len(links) {
+		t.Errorf("expecting the queue length to be %d, got %d", len(links), c.frontier.Len())
+	}
+}
+
 func TestIsDone(t *testing.T) {
 	c, err := NewCrawler("https://example.com", 1, 10, 200, fetcher.NewMockFetcher(fakeWebsites), sitemap.NewMemorySitemap())
 	if err != nil {
@@ -149,15 +182,673 @@ func TestIsDone(t *testing.T) {
 	}
 
 	// when the queue has at least one link IsDone must return false
-	c.queueFilteredLinks([]string{"http://community.example.com/"})
+	c.queueFilteredLinks([]string{"http://community.example.com/"}, 1)
 	if c.IsDone() {
 		t.Errorf("expecting the crawler to be still active")
 	}
 
 	// emptying the queue and ecpecting the crawler to finish
+	c.wg.Add(1)
 	go c.crawlQueue()
 	time.Sleep(1 * time.Second)
 	if !c.IsDone() {
 		t.Errorf("expecting the crawling to be finished")
 	}
 }
+
+func TestQueueFilteredLinksRobots(t *testing.T) {
+	websites := map[string][]byte{
+		"https://example.com/robots.txt": []byte("User-agent: *\nDisallow: /private\n"),
+	}
+	sm := sitemap.NewMemorySitemap()
+	c, err := NewCrawler("https://example.com", 1, 10, 200, fetcher.NewMockFetcher(websites), sm, WithRobots("millipedes"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	c.queueFilteredLinks([]string{"https://example.com/private/page", "https://example.com/public"}, 1)
+	if c.frontier.Len() != 1 {
+		t.Errorf("expecting the queue length to be 1 because robots.txt disallows one of the two links")
+	}
+
+	pages := sm.GetPages()
+	p, ok := pages["https://example.com/private/page"]
+	if !ok || p.Skipped != sitemap.ReasonRobots {
+		t.Errorf("expecting the disallowed link to be in the sitemap marked as %q, got %+v", sitemap.ReasonRobots, p)
+	}
+	if _, ok := pages["https://example.com/public"]; ok {
+		t.Errorf("expecting the allowed link not to be marked")
+	}
+}
+
+// gatedFetcher wraps a fetcher and blocks fetching a URL until its gate is opened
+type gatedFetcher struct {
+	fetcher  fetcher.Fetcher
+	gateURL  string
+	fetching chan struct{}
+	gate     chan struct{}
+}
+
+func (f *gatedFetcher) Fetch(url string) (*fetcher.Response, error) {
+	if url == f.gateURL {
+		close(f.fetching)
+		<-f.gate
+	}
+	return f.fetcher.Fetch(url)
+}
+
+func TestWait(t *testing.T) {
+	sm := sitemap.NewMemorySitemap()
+	c, err := NewCrawler("https://example.com", 4, 10, 1, fetcher.NewMockFetcher(fakeWebsites), sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Start()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Wait(ctx); err != nil {
+		t.Fatalf("expecting the crawl to finish, got %s", err)
+	}
+	if !c.IsDone() || !c.Complete() {
+		t.Error("expecting the crawl to be done and complete after Wait returned")
+	}
+	if c.frontier.Len() != 0 {
+		t.Errorf("expecting the queue to be drained, got %d elements", c.frontier.Len())
+	}
+	c.Shutdown()
+
+	crawled := []string{}
+	for url := range sm.GetSitemap() {
+		crawled = append(crawled, url)
+	}
+	sort.Strings(crawled)
+	expected := []string{"https://example.com", "https://example.com/careers", "https://example.com/contact-us"}
+	if !reflect.DeepEqual(crawled, expected) {
+		t.Errorf("expecting crawled pages %v, got %v", expected, crawled)
+	}
+}
+
+func TestDoneWhileFetching(t *testing.T) {
+	f := &gatedFetcher{
+		fetcher:  fetcher.NewMockFetcher(fakeWebsites),
+		gateURL:  "https://example.com",
+		fetching: make(chan struct{}),
+		gate:     make(chan struct{}),
+	}
+	c, err := NewCrawler("https://example.com", 2, 10, 1, f, sitemap.NewMemorySitemap())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Start()
+	<-f.fetching
+
+	// the queue is empty but the entrypoint is still being fetched, so links are yet to be queued
+	if c.frontier.Len() != 0 {
+		t.Fatalf("expecting the queue to be empty while the entrypoint is fetched")
+	}
+	select {
+	case <-c.Done():
+		t.Fatal("expecting the crawler not to be done while a page is being fetched")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(f.gate)
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expecting the crawler to be done once the frontier drained")
+	}
+	c.Shutdown()
+}
+
+func TestWaitCancelled(t *testing.T) {
+	f := &gatedFetcher{
+		fetcher:  fetcher.NewMockFetcher(fakeWebsites),
+		gateURL:  "https://example.com",
+		fetching: make(chan struct{}),
+		gate:     make(chan struct{}),
+	}
+	c, err := NewCrawler("https://example.com", 1, 10, 1, f, sitemap.NewMemorySitemap())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Start()
+	<-f.fetching
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.Wait(ctx); err != context.Canceled {
+		t.Errorf("expecting Wait to return %s, got %v", context.Canceled, err)
+	}
+
+	close(f.gate)
+	c.Shutdown()
+	if !c.IsDone() {
+		t.Error("expecting the crawler to be done after shutting down")
+	}
+	if c.Complete() {
+		t.Error("expecting the crawl shut down while fetching not to be complete")
+	}
+}
+
+func TestFullQueueDoesNotBlock(t *testing.T) {
+	websites := map[string][]byte{
+		"https://example.com":            []byte(threelinks),
+		"https://example.com/contact-us": []byte(threelinks),
+		"https://example.com/careers":    []byte(threelinks),
+		"https://example.com/blog":       []byte(threelinks),
+	}
+	sm := sitemap.NewMemorySitemap()
+	// a single worker and room for a single URL in memory: the rest must spill to disk
+	c, err := NewCrawler("https://example.com", 1, 1, 1, fetcher.NewMockFetcher(websites), sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Start()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Wait(ctx); err != nil {
+		t.Fatalf("expecting the crawl to finish, got %s", err)
+	}
+	c.Shutdown()
+
+	if len(sm.GetSitemap()) != len(websites) {
+		t.Errorf("expecting %d pages to be crawled, got %d", len(websites), len(sm.GetSitemap()))
+	}
+}
+
+func TestBoundedFrontier(t *testing.T) {
+	c, err := NewCrawler("https://example.com", 1, 10, 1, fetcher.NewMockFetcher(fakeWebsites), sitemap.NewMemorySitemap(), WithFrontier(frontier.NewBoundedFrontier(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the second link doesn't fit but queuing must not block and it must not be marked as seen
+	c.queueFilteredLinks([]string{"https://example.com/contact-us", "https://example.com/careers"}, 1)
+	if c.frontier.Len() != 1 {
+		t.Errorf("expecting the frontier length to be 1, got %d", c.frontier.Len())
+	}
+	if c.isURLSeen("https://example.com/careers") {
+		t.Error("expecting the link that didn't fit in the frontier not to be seen")
+	}
+	if c.IsDone() {
+		t.Error("expecting the crawler to be still active")
+	}
+}
+
+func TestLimits(t *testing.T) {
+	chain := map[string][]byte{
+		"https://example.com":   []byte(fmt.Sprintf(template, "<a href='https://example.com/1'></a>")),
+		"https://example.com/1": []byte(fmt.Sprintf(template, "<a href='https://example.com/2'></a><a href='https://example.com/3'></a>")),
+		"https://example.com/2": []byte(fmt.Sprintf(template, "<a href='https://example.com/4'></a>")),
+		"https://example.com/3": []byte(nolinks),
+		"https://example.com/4": []byte(nolinks),
+	}
+
+	tt := []struct {
+		limits  Limits
+		crawled int
+	}{
+		{Limits{}, 5},
+		{Limits{MaxDepth: 1}, 2},
+		{Limits{MaxDepth: 2}, 4},
+		{Limits{MaxPages: 3}, 3},
+		{Limits{MaxDepth: 2, MaxPages: 2}, 2},
+	}
+
+	for _, tc := range tt {
+		sm := sitemap.NewMemorySitemap()
+		c, err := NewCrawler("https://example.com", 2, 10, 1, fetcher.NewMockFetcher(chain), sm, WithLimits(tc.limits))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Start()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = c.Wait(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("expecting the crawl with limits %+v to finish, got %s", tc.limits, err)
+		}
+		c.Shutdown()
+
+		if len(sm.GetSitemap()) != tc.crawled {
+			t.Errorf("expecting %d pages crawled with limits %+v, got %d", tc.crawled, tc.limits, len(sm.GetSitemap()))
+		}
+		for url, p := range sm.GetPages() {
+			if tc.limits.MaxDepth > 0 && p.Depth > tc.limits.MaxDepth {
+				t.Errorf("expecting %s to be within depth %d, got %d", url, tc.limits.MaxDepth, p.Depth)
+			}
+		}
+	}
+}
+
+func TestPageDepth(t *testing.T) {
+	sm := sitemap.NewMemorySitemap()
+	c, err := NewCrawler("https://example.com", 1, 10, 1, fetcher.NewMockFetcher(fakeWebsites), sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Start()
+	<-c.Done()
+	c.Shutdown()
+
+	expected := map[string]int{
+		"https://example.com":            0,
+		"https://example.com/contact-us": 1,
+		"https://example.com/careers":    1,
+	}
+	pages := sm.GetPages()
+	for url, depth := range expected {
+		if pages[url].Depth != depth {
+			t.Errorf("expecting %s to have depth %d, got %d", url, depth, pages[url].Depth)
+		}
+	}
+}
+
+func TestMaxDuration(t *testing.T) {
+	f := &gatedFetcher{
+		fetcher:  fetcher.NewMockFetcher(fakeWebsites),
+		gateURL:  "https://example.com/contact-us",
+		fetching: make(chan struct{}),
+		gate:     make(chan struct{}),
+	}
+	c, err := NewCrawler("https://example.com", 1, 10, 1, f, sitemap.NewMemorySitemap(), WithLimits(Limits{MaxDuration: 100 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Start()
+	<-f.fetching
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		close(f.gate)
+	}()
+
+	// the crawl must stop after the page being fetched is completed, leaving the rest of the frontier
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expecting the crawl to stop after the maximum duration")
+	}
+	if c.Complete() {
+		t.Error("expecting the crawl stopped by the maximum duration not to be complete")
+	}
+	c.Shutdown()
+}
+
+func TestQueueFilteredLinksFilter(t *testing.T) {
+	f, err := filter.New([]string{"prefix:/docs/"}, []string{"re:\\.pdf$"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := sitemap.NewMemorySitemap()
+	c, err := NewCrawler("https://example.com/docs/", 1, 10, 200, fetcher.NewMockFetcher(fakeWebsites), sm, WithFilter(f))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.queueFilteredLinks([]string{"https://example.com/docs/intro", "https://example.com/docs/manual.pdf", "https://example.com/careers"}, 1)
+	if c.frontier.Len() != 1 {
+		t.Errorf("expecting the queue length to be 1 because two links are filtered, got %d", c.frontier.Len())
+	}
+
+	pages := sm.GetPages()
+	for _, url := range []string{"https://example.com/docs/manual.pdf", "https://example.com/careers"} {
+		if pages[url].Skipped != sitemap.ReasonFiltered {
+			t.Errorf("expecting %s to be in the sitemap marked as %q, got %+v", url, sitemap.ReasonFiltered, pages[url])
+		}
+	}
+}
+
+func TestNormalizedCrawl(t *testing.T) {
+	websites := map[string][]byte{
+		"https://example.com/":        []byte(fmt.Sprintf(template, "<a href='https://example.com'></a><a href='https://EXAMPLE.com/#top'></a><a href='https://example.com/careers?utm_source=x'></a>")),
+		"https://example.com/careers": []byte(fmt.Sprintf(template, "<a href='https://example.com:443/'></a><a href='https://example.com/careers#jobs'></a>")),
+	}
+	sm := sitemap.NewMemorySitemap()
+	c, err := NewCrawler("https://EXAMPLE.com", 1, 10, 1, fetcher.NewMockFetcher(websites), sm, WithNormalizer(normalizer.New(normalizer.DefaultTrackingParams, false)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Start()
+	<-c.Done()
+	c.Shutdown()
+
+	crawled := []string{}
+	for url := range sm.GetSitemap() {
+		crawled = append(crawled, url)
+	}
+	sort.Strings(crawled)
+	expected := []string{"https://example.com/", "https://example.com/careers"}
+	if !reflect.DeepEqual(crawled, expected) {
+		t.Errorf("expecting crawled pages %v, got %v", expected, crawled)
+	}
+}
+
+// throttledFetcher replies 429 Too Many Requests to every request
+type throttledFetcher struct {
+	retryAfter time.Duration
+}
+
+func (f *throttledFetcher) Fetch(url string) (*fetcher.Response, error) {
+	return nil, &fetcher.Error{URL: url, Kind: fetcher.KindStatus, StatusCode: 429, RetryAfter: f.retryAfter}
+}
+
+func TestBackoff(t *testing.T) {
+	c, err := NewCrawler("https://example.com", 1, 10, 1, &throttledFetcher{retryAfter: time.Hour}, sitemap.NewMemorySitemap())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.processURL("https://example.com", 0); err == nil {
+		t.Fatal("expecting an error fetching a throttled page")
+	}
+
+	// the host must not be handed out again before Retry-After, while other hosts are
+	c.enqueue("https://example.com/careers", 1)
+	c.enqueue("https://other.com", 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	item, release, err := c.scheduler.Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if item.URL != "https://other.com" {
+		t.Errorf("expecting https://other.com to be fetched first, got %s", item.URL)
+	}
+	if _, _, err := c.scheduler.Next(ctx); err == nil {
+		t.Error("expecting the throttled host not to be fetched")
+	}
+}
+
+func TestFailedPage(t *testing.T) {
+	sm := sitemap.NewMemorySitemap()
+	websites := map[string][]byte{
+		"https://example.com": []byte(fmt.Sprintf(template, "<a href='https://example.com/broken'></a><a href='https://example.com/moved'></a>")),
+	}
+	f := fetcher.NewMockFetcher(websites)
+	f.AddRedirect("https://example.com/moved", "https://example.com/gone", 301)
+	c, err := NewCrawler("https://example.com", 1, 10, 1, f, sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Start()
+	<-c.Done()
+	c.Shutdown()
+
+	pages := sm.GetPages()
+	if r := pages["https://example.com"].Response; r == nil || r.Status != 200 || r.FinalURL != "https://example.com" || r.ContentType != "text/html; charset=utf-8" {
+		t.Errorf("expecting the response metadata to be stored, got %+v", r)
+	}
+	if pages["https://example.com"].Status != 200 || pages["https://example.com"].Broken() {
+		t.Errorf("expecting the status of the page to be stored, got %+v", pages["https://example.com"])
+	}
+
+	tt := []struct {
+		url    string
+		status int
+		broken bool
+	}{
+		{url: "https://example.com/broken", status: 404, broken: true},
+		{url: "https://example.com/moved", status: 301},
+		// the redirect target is recorded with the error, not the URL redirecting to it
+		{url: "https://example.com/gone", status: 404, broken: true},
+	}
+	for _, tc := range tt {
+		if !sm.IsURLPresent(tc.url) {
+			t.Errorf("expecting %s to be part of the sitemap", tc.url)
+		}
+		p := pages[tc.url]
+		if p.Status != tc.status || p.Broken() != tc.broken || p.Depth != 1 {
+			t.Errorf("expecting %s to be recorded with status %d, got %+v", tc.url, tc.status, p)
+		}
+		if tc.broken && (p.ErrorKind != string(fetcher.KindStatus) || p.Attempts != 1) {
+			t.Errorf("expecting %s to be recorded with its error, got %+v", tc.url, p)
+		}
+	}
+}
+
+func TestNonHTMLResource(t *testing.T) {
+	sm := sitemap.NewMemorySitemap()
+	websites := map[string][]byte{
+		"https://example.com":          []byte(fmt.Sprintf(template, "<a href='https://example.com/logo.png'></a>")),
+		"https://example.com/logo.png": []byte("\x89PNG\r\n\x1a\n<a href='https://example.com/careers'></a>"),
+		"https://example.com/careers":  []byte(nolinks),
+	}
+	c, err := NewCrawler("https://example.com", 1, 10, 1, fetcher.NewMockFetcher(websites), sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Start()
+	<-c.Done()
+	c.Shutdown()
+
+	if children := sm.GetSitemap()["https://example.com/logo.png"]; len(children) != 0 {
+		t.Errorf("expecting the image to be a leaf, got children %v", children)
+	}
+	if sm.IsURLPresent("https://example.com/careers") {
+		t.Error("expecting the links in the image not to be followed")
+	}
+	pages := sm.GetPages()
+	if pages["https://example.com"].Resource != sitemap.ResourceHTML || pages["https://example.com/logo.png"].Resource != sitemap.ResourceImage {
+		t.Errorf("expecting the resource types to be recorded, got %+v", pages)
+	}
+}
+
+func TestRedirects(t *testing.T) {
+	sm := sitemap.NewMemorySitemap()
+	websites := map[string][]byte{
+		"https://example.com":         []byte(fmt.Sprintf(template, "<a href='/old'></a><a href='/loop'></a>")),
+		"https://example.com/new":     []byte(fmt.Sprintf(template, "<a href='careers'></a>")),
+		"https://example.com/careers": []byte(nolinks),
+	}
+	f := fetcher.NewMockFetcher(websites)
+	f.AddRedirect("https://example.com/old", "https://example.com/new", 301)
+	f.AddRedirect("https://example.com/loop", "https://example.com/loop", 302)
+	c, err := NewCrawler("https://example.com", 1, 10, 1, f, sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Start()
+	<-c.Done()
+	c.Shutdown()
+
+	links := sm.GetLinks()
+	expected := map[string][]sitemap.Link{
+		"https://example.com":         {{URL: "https://example.com/old", Kind: "anchor"}, {URL: "https://example.com/loop", Kind: "anchor"}},
+		"https://example.com/old":     {{URL: "https://example.com/new", Redirect: 301}},
+		"https://example.com/new":     {{URL: "https://example.com/careers", Kind: "anchor"}},
+		"https://example.com/careers": {},
+		"https://example.com/loop":    {{URL: "https://example.com/loop", Redirect: 302}},
+	}
+	if !reflect.DeepEqual(links, expected) {
+		t.Errorf("expecting links %v, got %v", expected, links)
+	}
+
+	pages := sm.GetPages()
+	if r := pages["https://example.com/new"].Response; r == nil || len(r.Redirects) != 1 || pages["https://example.com/old"].Response != nil {
+		t.Errorf("expecting the response to be stored under the final URL, got %+v", pages)
+	}
+	if pages["https://example.com/loop"].Error == "" {
+		t.Error("expecting the redirect loop to be recorded as an error")
+	}
+}
+
+func TestRelativeLinks(t *testing.T) {
+	sm := sitemap.NewMemorySitemap()
+	websites := map[string][]byte{
+		"https://example.com":            []byte(fmt.Sprintf(template, "<a href='/about/'></a>")),
+		"https://example.com/about/":     []byte(fmt.Sprintf(template, "<a href='team'></a>")),
+		"https://example.com/about/team": []byte(nolinks),
+	}
+	c, err := NewCrawler("https://example.com", 1, 10, 1, fetcher.NewMockFetcher(websites), sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Start()
+	<-c.Done()
+	c.Shutdown()
+
+	if !sm.IsURLPresent("https://example.com/about/team") {
+		t.Errorf("expecting team to be resolved against /about/, got %v", sm.GetSitemap())
+	}
+}
+
+func TestFollowPolicy(t *testing.T) {
+	body := fmt.Sprintf(template, `<a href="/about"></a><img src="/logo.png"><iframe src="/embed"></iframe><form action="/search"></form>`)
+	websites := map[string][]byte{
+		"https://example.com":          []byte(body),
+		"https://example.com/about":    []byte(nolinks),
+		"https://example.com/embed":    []byte(nolinks),
+		"https://example.com/logo.png": []byte("\x89PNG\r\n\x1a\n"),
+		"https://example.com/search":   []byte(nolinks),
+	}
+
+	tt := []struct {
+		opts    []Option
+		crawled []string
+	}{
+		{nil, []string{"https://example.com", "https://example.com/about", "https://example.com/embed"}},
+		{[]Option{WithFollow(parser.KindAnchor, parser.KindImage)}, []string{"https://example.com", "https://example.com/about", "https://example.com/logo.png"}},
+	}
+
+	for _, tc := range tt {
+		sm := sitemap.NewMemorySitemap()
+		c, err := NewCrawler("https://example.com", 1, 10, 1, fetcher.NewMockFetcher(websites), sm, tc.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Start()
+		<-c.Done()
+		c.Shutdown()
+
+		crawled := []string{}
+		for url := range sm.GetSitemap() {
+			crawled = append(crawled, url)
+		}
+		sort.Strings(crawled)
+		if !reflect.DeepEqual(crawled, tc.crawled) {
+			t.Errorf("expecting crawled pages %v, got %v", tc.crawled, crawled)
+		}
+		if links := sm.GetLinks()["https://example.com"]; len(links) != 4 || links[1].Kind != "image" || links[3].Kind != "form" {
+			t.Errorf("expecting all the links to be recorded with their kind, got %v", links)
+		}
+	}
+}
+
+func TestNonNavigableLinks(t *testing.T) {
+	sm := sitemap.NewMemorySitemap()
+	websites := map[string][]byte{
+		"https://example.com":       []byte(fmt.Sprintf(template, `<a href="mailto:info@example.com"></a><a href="javascript:void(0)"></a><a href="http://[::1"></a><a href="/about"></a>`)),
+		"https://example.com/about": []byte(nolinks),
+	}
+	c, err := NewCrawler("https://example.com", 1, 10, 1, fetcher.NewMockFetcher(websites), sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Start()
+	<-c.Done()
+	c.Shutdown()
+
+	children := sm.GetSitemap()["https://example.com"]
+	if !reflect.DeepEqual(children, []string{"https://example.com/about"}) {
+		t.Errorf("expecting only the navigable link to be a child, got %v", children)
+	}
+	p := sm.GetPages()["https://example.com"]
+	expected := []sitemap.Link{{URL: "mailto:info@example.com", Kind: "anchor"}, {URL: "javascript:void(0)", Kind: "anchor"}}
+	if !reflect.DeepEqual(p.NonNavigable, expected) {
+		t.Errorf("expecting non-navigable links %v, got %v", expected, p.NonNavigable)
+	}
+	if len(p.Warnings) != 1 {
+		t.Errorf("expecting a warning for the malformed link, got %v", p.Warnings)
+	}
+}
+
+// headerFetcher wraps a fetcher and adds headers to the responses of some URLs
+type headerFetcher struct {
+	fetcher fetcher.Fetcher
+	headers map[string]http.Header
+}
+
+func (f *headerFetcher) Fetch(url string) (*fetcher.Response, error) {
+	resp, err := f.fetcher.Fetch(url)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range f.headers[url] {
+		resp.Header[k] = v
+	}
+	return resp, nil
+}
+
+func TestNofollow(t *testing.T) {
+	websites := map[string][]byte{
+		"https://example.com":        []byte(fmt.Sprintf(template, `<a href="/a"></a><a href="/b" rel="nofollow"></a><a href="/meta"></a><a href="/header"></a>`)),
+		"https://example.com/a":      []byte(nolinks),
+		"https://example.com/b":      []byte(nolinks),
+		"https://example.com/meta":   []byte(`<html><head><meta name="robots" content="noindex,nofollow"></head><body><a href="/c"></a></body></html>`),
+		"https://example.com/c":      []byte(nolinks),
+		"https://example.com/header": []byte(fmt.Sprintf(template, `<a href="/d"></a>`)),
+		"https://example.com/d":      []byte(nolinks),
+	}
+	headers := map[string]http.Header{
+		"https://example.com/header": {"X-Robots-Tag": []string{"millipedes: nofollow", "otherbot: noindex"}},
+	}
+
+	tt := []struct {
+		opts    []Option
+		crawled []string
+	}{
+		{
+			[]Option{WithUserAgent("millipedes")},
+			[]string{"https://example.com", "https://example.com/a", "https://example.com/header", "https://example.com/meta"},
+		},
+		{
+			[]Option{WithUserAgent("millipedes"), WithFollowNofollow()},
+			[]string{"https://example.com", "https://example.com/a", "https://example.com/b", "https://example.com/c", "https://example.com/d", "https://example.com/header", "https://example.com/meta"},
+		},
+	}
+
+	for _, tc := range tt {
+		sm := sitemap.NewMemorySitemap()
+		f := &headerFetcher{fetcher: fetcher.NewMockFetcher(websites), headers: headers}
+		c, err := NewCrawler("https://example.com", 1, 10, 1, f, sm, tc.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Start()
+		<-c.Done()
+		c.Shutdown()
+
+		crawled := []string{}
+		for url := range sm.GetSitemap() {
+			crawled = append(crawled, url)
+		}
+		sort.Strings(crawled)
+		if !reflect.DeepEqual(crawled, tc.crawled) {
+			t.Errorf("expecting crawled pages %v, got %v", tc.crawled, crawled)
+		}
+
+		pages := sm.GetPages()
+		if meta := pages["https://example.com/meta"]; !meta.NoIndex || !meta.NoFollow {
+			t.Errorf("expecting the meta robots directives to be recorded, got %+v", meta)
+		}
+		if header := pages["https://example.com/header"]; header.NoIndex || !header.NoFollow {
+			t.Errorf("expecting only the X-Robots-Tag directives for the user agent to be recorded, got %+v", header)
+		}
+		links := sm.GetLinks()["https://example.com"]
+		if len(links) != 4 || links[0].Nofollow || !links[1].Nofollow {
+			t.Errorf("expecting the nofollow links to be flagged, got %v", links)
+		}
+	}
+}
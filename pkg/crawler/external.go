@@ -0,0 +1,114 @@
+package crawler
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/amartorelli/millipedes/pkg/crawler/fetcher"
+	"github.com/amartorelli/millipedes/pkg/crawler/frontier"
+	"github.com/amartorelli/millipedes/pkg/crawler/scheduler"
+	"github.com/amartorelli/millipedes/pkg/crawler/sitemap"
+	"github.com/sirupsen/logrus"
+)
+
+// externalLinks returns the targets of the links outside of the scope of the crawl which haven't been
+// fetched, with the depth they're first reached at. The sitemap is streamed rather than loaded as a graph.
+func (c *Crawler) externalLinks() map[string]int {
+	depths := make(map[string]int, 0)
+	c.sitemap.RangePages(func(p sitemap.Page) bool {
+		depths[p.URL] = p.Depth
+		return true
+	})
+	external := make(map[string]int, 0)
+	c.sitemap.RangeLinks(func(url string, links []sitemap.Link) bool {
+		for _, l := range links {
+			if _, ok := depths[l.URL]; ok || c.isSameDomain(l.URL) {
+				continue
+			}
+			if depth, ok := external[l.URL]; !ok || depths[url]+1 < depth {
+				external[l.URL] = depths[url] + 1
+			}
+		}
+		return true
+	})
+	return external
+}
+
+// CheckExternal checks the links to the URLs outside of the scope of the crawl, which aren't followed,
+// with HEAD requests sent by up to workers goroutines, and stores their outcome in the sitemap as leaves,
+// so that the broken ones are reported like the crawled pages. The requests are scheduled with the same
+// per host limits as the crawl. It's meant to be called once the crawl is over and returns the number
+// of URLs checked.
+func (c *Crawler) CheckExternal(workers int) int {
+	external := c.externalLinks()
+	urls := make([]string, 0, len(external))
+	for url := range external {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	check := c.fetcher.Fetch
+	if checker, ok := c.fetcher.(fetcher.Checker); ok {
+		check = checker.Head
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	if len(urls) == 0 {
+		return 0
+	}
+
+	s := scheduler.New(frontier.NewSpillFrontier(len(urls), ""), c.interval, c.burst, c.hostConns, 2*workers)
+	defer s.Close()
+	for _, url := range urls {
+		if err := s.Push(frontier.Item{URL: url, Depth: external[url]}); err != nil {
+			logrus.Errorf("error queuing %s: %s", url, err)
+			return 0
+		}
+	}
+
+	// the workers stop once every URL has been checked
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	remaining := int64(len(urls))
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				item, release, err := s.Next(ctx)
+				if err != nil {
+					return
+				}
+				c.checkExternal(item.URL, item.Depth, check)
+				release()
+				if atomic.AddInt64(&remaining, -1) == 0 {
+					cancel()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return len(urls)
+}
+
+// checkExternal checks a URL outside of the scope of the crawl, without following its redirects in the sitemap
+func (c *Crawler) checkExternal(url string, depth int, check func(url string) (*fetcher.Response, error)) {
+	logrus.Debugf("checking %s", url)
+	resp, err := check(url)
+	if err != nil {
+		logrus.Debug(err)
+		c.sitemap.UpdatePage(url, failure(depth, err))
+	} else {
+		c.sitemap.UpdatePage(url, func(p *sitemap.Page) {
+			p.Depth = depth
+			p.Status = resp.StatusCode
+			p.Resource = sitemap.ResourceType(fetcher.MediaType(resp.ContentType))
+			p.Response = pageResponse(resp)
+		})
+	}
+	c.sitemap.AddChildren(url, nil)
+}
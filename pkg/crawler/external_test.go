@@ -0,0 +1,126 @@
+package crawler
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amartorelli/millipedes/pkg/crawler/fetcher"
+	"github.com/amartorelli/millipedes/pkg/crawler/sitemap"
+)
+
+// headFetcher records the URLs checked with HEAD requests
+type headFetcher struct {
+	*fetcher.MockFetcher
+	heads []string
+	mux   *sync.Mutex
+}
+
+func (f *headFetcher) Head(url string) (*fetcher.Response, error) {
+	f.mux.Lock()
+	f.heads = append(f.heads, url)
+	f.mux.Unlock()
+	return f.MockFetcher.Head(url)
+}
+
+func TestCheckExternal(t *testing.T) {
+	sm := sitemap.NewMemorySitemap()
+	websites := map[string][]byte{
+		"https://example.com":       []byte(fmt.Sprintf(template, "<a href='/about'></a><a href='https://other.com/page'></a><a href='https://gone.com'></a>")),
+		"https://example.com/about": []byte(fmt.Sprintf(template, "<a href='https://other.com/page'></a><a href='/missing'></a>")),
+		"https://other.com/page":    []byte(fmt.Sprintf(template, "<a href='https://other.com/next'></a>")),
+		"https://other.com/next":    []byte(nolinks),
+	}
+	f := &headFetcher{MockFetcher: fetcher.NewMockFetcher(websites), mux: &sync.Mutex{}}
+	c, err := NewCrawler("https://example.com", 2, 10, 1, f, sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Start()
+	<-c.Done()
+	c.Shutdown()
+	if n := c.CheckExternal(2); n != 2 {
+		t.Errorf("expecting 2 external links to be checked, got %d", n)
+	}
+
+	sort.Strings(f.heads)
+	if expected := []string{"https://gone.com", "https://other.com/page"}; !reflect.DeepEqual(f.heads, expected) {
+		t.Errorf("expecting only the external links to be checked with HEAD requests, got %v", f.heads)
+	}
+	pages := sm.GetPages()
+	tt := []struct {
+		url    string
+		status int
+		depth  int
+		broken bool
+	}{
+		{url: "https://other.com/page", status: 200, depth: 1},
+		{url: "https://gone.com", status: 404, depth: 1, broken: true},
+		{url: "https://example.com/missing", status: 404, depth: 2, broken: true},
+	}
+	for _, tc := range tt {
+		p, ok := pages[tc.url]
+		if !ok || p.Status != tc.status || p.Depth != tc.depth || p.Broken() != tc.broken {
+			t.Errorf("expecting %s to be recorded with status %d, got %+v", tc.url, tc.status, p)
+		}
+	}
+	// the links of the external pages aren't followed
+	if links := sm.GetLinks()["https://other.com/page"]; len(links) != 0 {
+		t.Errorf("expecting the external page to be a leaf, got %v", links)
+	}
+	if _, ok := pages["https://other.com/next"]; ok {
+		t.Error("expecting the links of the external page not to be checked")
+	}
+}
+
+// concurrencyFetcher records the maximum number of concurrent HEAD requests
+type concurrencyFetcher struct {
+	*fetcher.MockFetcher
+	inflight int
+	max      int
+	mux      *sync.Mutex
+}
+
+func (f *concurrencyFetcher) Head(url string) (*fetcher.Response, error) {
+	f.mux.Lock()
+	f.inflight++
+	if f.inflight > f.max {
+		f.max = f.inflight
+	}
+	f.mux.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	f.mux.Lock()
+	f.inflight--
+	f.mux.Unlock()
+	return f.MockFetcher.Head(url)
+}
+
+func TestCheckExternalHostLimits(t *testing.T) {
+	links := ""
+	for i := 0; i < 8; i++ {
+		links += fmt.Sprintf("<a href='https://other.com/%d'></a>", i)
+	}
+	websites := map[string][]byte{
+		"https://example.com": []byte(fmt.Sprintf(template, links)),
+	}
+	f := &concurrencyFetcher{MockFetcher: fetcher.NewMockFetcher(websites), mux: &sync.Mutex{}}
+	c, err := NewCrawler("https://example.com", 2, 10, 0, f, sitemap.NewMemorySitemap(), WithHostLimits(1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Start()
+	<-c.Done()
+	c.Shutdown()
+	if n := c.CheckExternal(4); n != 8 {
+		t.Errorf("expecting 8 external links to be checked, got %d", n)
+	}
+	// all the links are to the same host, which accepts a single request at a time
+	if f.max != 1 {
+		t.Errorf("expecting at most 1 concurrent request to the external host, got %d", f.max)
+	}
+}
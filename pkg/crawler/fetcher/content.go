@@ -0,0 +1,45 @@
+package fetcher
+
+import (
+	"mime"
+	"strings"
+)
+
+// DefaultMaxBodySize is the maximum size in bytes of the bodies read by HTTPFetcher unless configured otherwise
+const DefaultMaxBodySize = 10 << 20
+
+// sniffLen is the number of bytes used to detect the content type when the server doesn't send it
+const sniffLen = 512
+
+// MediaType returns the lowercase media type of a Content-Type, without parameters
+func MediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.TrimSpace(strings.Split(contentType, ";")[0])
+	}
+	return strings.ToLower(mediaType)
+}
+
+// IsHTML returns true if the content type is HTML or XHTML
+func IsHTML(contentType string) bool {
+	switch MediaType(contentType) {
+	case "text/html", "application/xhtml+xml":
+		return true
+	}
+	return false
+}
+
+// isReadable returns true if the body of a response with this content type should be read:
+// HTML pages are parsed and plain text is needed for robots.txt, everything else is only recorded
+func isReadable(contentType string) bool {
+	return IsHTML(contentType) || MediaType(contentType) == "text/plain"
+}
+
+// needsSniffing returns true if the content type sent by the server doesn't tell what the body is
+func needsSniffing(contentType string) bool {
+	switch MediaType(contentType) {
+	case "", "application/octet-stream", "application/unknown", "unknown/unknown":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package fetcher
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Kind classifies the reason why a URL couldn't be fetched
+type Kind string
+
+const (
+	// KindNetwork is a connection error, e.g. the connection was refused or reset
+	KindNetwork Kind = "network"
+	// KindTimeout is returned when the server didn't reply in time
+	KindTimeout Kind = "timeout"
+	// KindDNS is returned when the host name couldn't be resolved
+	KindDNS Kind = "dns"
+	// KindTLS is a TLS handshake or certificate verification error
+	KindTLS Kind = "tls"
+	// KindStatus is returned when the server replies with a status code other than 2xx
+	KindStatus Kind = "http status"
+	// KindTooLarge is returned when the body is bigger than the maximum size
+	KindTooLarge Kind = "too large"
+	// KindRedirect is returned when the redirects loop or are too many to follow
+	KindRedirect Kind = "redirect"
+)
+
+// Error is returned when a URL can't be fetched
+type Error struct {
+	URL  string
+	Kind Kind
+	// StatusCode is the status code of the response for KindStatus errors
+	StatusCode int
+	// RetryAfter is the delay requested by the server with the Retry-After header, if any
+	RetryAfter time.Duration
+	// Attempts is the number of requests sent before giving up
+	Attempts int
+	// Redirects is the chain of redirects followed before the error, if any
+	Redirects []Redirect
+	// Err is the underlying error, nil for KindStatus errors
+	Err error
+}
+
+// Error returns the error message
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("error fetching %s: %s", e.URL, e.Err)
+	if e.Kind == KindStatus {
+		msg = fmt.Sprintf("%s response code %d", e.URL, e.StatusCode)
+	}
+	if e.Attempts > 1 {
+		msg = fmt.Sprintf("%s (%d attempts)", msg, e.Attempts)
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Retryable returns true if sending the request again might succeed
+func (e *Error) Retryable() bool {
+	switch e.Kind {
+	case KindNetwork, KindTimeout:
+		return true
+	case KindStatus:
+		switch e.StatusCode {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+	}
+	return false
+}
+
+// classify wraps an error returned by the HTTP client into an Error of the right kind
+func classify(url string, err error) *Error {
+	var (
+		dnsErr       *net.DNSError
+		netErr       net.Error
+		recordErr    tls.RecordHeaderError
+		verifyErr    *tls.CertificateVerificationError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+
+	kind := KindNetwork
+	switch {
+	case errors.Is(err, errRedirectLoop), errors.Is(err, errTooManyRedirects):
+		kind = KindRedirect
+	case errors.As(err, &dnsErr):
+		kind = KindDNS
+	case errors.As(err, &verifyErr), errors.As(err, &authorityErr), errors.As(err, &hostnameErr),
+		errors.As(err, &invalidErr), errors.As(err, &recordErr):
+		kind = KindTLS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		kind = KindTimeout
+	}
+	return &Error{URL: url, Kind: kind, Err: err}
+}
+
+// KindOf returns the kind of a fetch error, or an empty string if it's not an Error
+func KindOf(err error) Kind {
+	var fe *Error
+	if errors.As(err, &fe) {
+		return fe.Kind
+	}
+	return ""
+}
+
+// parseRetryAfter parses the value of a Retry-After header, either a number of seconds or a HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
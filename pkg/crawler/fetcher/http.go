@@ -1,45 +1,185 @@
 package fetcher
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
 // HTTPFetcher is a structure representing a Fetcher that uses a HTTP client
 type HTTPFetcher struct {
-	client *http.Client
+	client      *http.Client
+	userAgent   string
+	retry       RetryPolicy
+	maxBodySize int64
 }
 
-// NewHTTPFetcher returns a new HTTPFetcher
-func NewHTTPFetcher() *HTTPFetcher {
-	return &HTTPFetcher{
+// Option configures a HTTPFetcher
+type Option func(f *HTTPFetcher)
+
+// WithMaxBodySize sets the maximum size in bytes of the bodies downloaded, 0 meaning no limit.
+// Bigger downloads are aborted. By default DefaultMaxBodySize is used.
+func WithMaxBodySize(size int64) Option {
+	return func(f *HTTPFetcher) {
+		f.maxBodySize = size
+	}
+}
+
+// NewHTTPFetcher returns a new HTTPFetcher sending the given User-Agent header and
+// retrying the failed requests according to the retry policy
+func NewHTTPFetcher(userAgent string, retry RetryPolicy, opts ...Option) *HTTPFetcher {
+	f := &HTTPFetcher{
 		client: &http.Client{
-			Timeout: time.Second * 5,
+			Timeout:       time.Second * 5,
+			CheckRedirect: checkRedirect,
 		},
+		userAgent:   userAgent,
+		retry:       retry,
+		maxBodySize: DefaultMaxBodySize,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// Fetch fetches a url and returns the response. Errors are returned as *Error.
+func (f *HTTPFetcher) Fetch(url string) (*Response, error) {
+	return f.do(context.Background(), http.MethodGet, url)
+}
+
+// FetchContext fetches a url like Fetch, giving up waiting to retry a failed request once the
+// context is done and returning its last error. The request being sent isn't cancelled.
+func (f *HTTPFetcher) FetchContext(ctx context.Context, url string) (*Response, error) {
+	return f.do(ctx, http.MethodGet, url)
+}
+
+// Head checks a url with a HEAD request, without downloading it, and returns the response with an
+// empty body. The servers which don't support HEAD are sent a GET. Errors are returned as *Error.
+func (f *HTTPFetcher) Head(url string) (*Response, error) {
+	resp, err := f.do(context.Background(), http.MethodHead, url)
+	if fe, ok := err.(*Error); ok && fe.Kind == KindStatus &&
+		(fe.StatusCode == http.StatusMethodNotAllowed || fe.StatusCode == http.StatusNotImplemented) {
+		return f.Fetch(url)
 	}
+	return resp, err
 }
 
-// Fetch fetches a url and returns the body
-func (f *HTTPFetcher) Fetch(url string) (io.Reader, error) {
-	resp, err := f.client.Get(url)
+// do sends a request, retrying it according to the retry policy until the context is done
+func (f *HTTPFetcher) do(ctx context.Context, method, url string) (*Response, error) {
+	req, err := http.NewRequest(method, url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching %s: %s", url, err)
+		return nil, &Error{URL: url, Kind: KindNetwork, Attempts: 1, Err: err}
+	}
+	if f.userAgent != "" {
+		req.Header.Set("User-Agent", f.userAgent)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%s response code %d", url, resp.StatusCode)
+	for attempt := 1; ; attempt++ {
+		resp, err := f.fetch(url, req)
+		if err == nil {
+			return resp, nil
+		}
+		err.Attempts = attempt
+
+		delay, retry := f.retry.backoff(attempt, err)
+		if !retry {
+			return nil, err
+		}
+		logrus.Debugf("%s, retrying in %s", err, delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		}
 	}
-	defer resp.Body.Close()
+}
 
-	// read all so that we can close the body
-	body, err := ioutil.ReadAll(resp.Body)
+// fetch sends a single request, following the redirects
+func (f *HTTPFetcher) fetch(url string, req *http.Request) (*Response, *Error) {
+	tracer, ctx := newTracer(req.Context())
+	start := time.Now()
+	resp, err := f.client.Do(req.WithContext(ctx))
 	if err != nil {
-		return nil, err
+		fe := classify(url, err)
+		fe.Redirects = tracer.getRedirects()
+		return nil, fe
+	}
+
+	defer resp.Body.Close()
+
+	// any 2xx response is a success, e.g. 204 No Content or 206 Partial Content
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &Error{
+			URL:        url,
+			Kind:       KindStatus,
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+			Redirects:  tracer.getRedirects(),
+		}
 	}
 
-	return bytes.NewReader(body), nil
+	// sniff the content type from the first bytes of the body if the server didn't send it
+	contentType := resp.Header.Get("Content-Type")
+	br := bufio.NewReaderSize(resp.Body, sniffLen)
+	head := req.Method == http.MethodHead
+	if needsSniffing(contentType) && !head {
+		peek, err := br.Peek(sniffLen)
+		if err != nil && err != io.EOF {
+			return nil, classify(url, err)
+		}
+		contentType = http.DetectContentType(peek)
+	}
+
+	// only download the pages which are parsed, the other resources are leaves of the sitemap
+	size := resp.ContentLength
+	var body []byte
+	if isReadable(contentType) && !head {
+		if f.maxBodySize > 0 && resp.ContentLength > f.maxBodySize {
+			return nil, f.tooLarge(url)
+		}
+		r := io.Reader(br)
+		if f.maxBodySize > 0 {
+			r = io.LimitReader(br, f.maxBodySize+1)
+		}
+		// read all so that we can close the body
+		body, err = ioutil.ReadAll(r)
+		if err != nil {
+			return nil, classify(url, err)
+		}
+		if f.maxBodySize > 0 && int64(len(body)) > f.maxBodySize {
+			return nil, f.tooLarge(url)
+		}
+		size = int64(len(body))
+	}
+	if size < 0 {
+		size = 0
+	}
+
+	return &Response{
+		URL:         url,
+		FinalURL:    resp.Request.URL.String(),
+		StatusCode:  resp.StatusCode,
+		Redirects:   tracer.getRedirects(),
+		Header:      resp.Header,
+		ContentType: contentType,
+		Size:        size,
+		Latency:     time.Since(start),
+		Timings:     tracer.getTimings(),
+		Body:        bytes.NewReader(body),
+	}, nil
+}
+
+// tooLarge returns the error aborting a download bigger than the maximum body size
+func (f *HTTPFetcher) tooLarge(url string) *Error {
+	return &Error{URL: url, Kind: KindTooLarge, Err: fmt.Errorf("body larger than %d bytes", f.maxBodySize)}
 }
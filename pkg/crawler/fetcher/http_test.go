@@ -0,0 +1,374 @@
+package fetcher
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			if r.UserAgent() != "millipedes" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte("<html></html>"))
+		case "/old":
+			http.Redirect(w, r, "/moved", http.StatusMovedPermanently)
+		case "/moved":
+			http.Redirect(w, r, "/", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop2", http.StatusMovedPermanently)
+		case "/loop2":
+			http.Redirect(w, r, "/loop", http.StatusMovedPermanently)
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		case "/busy":
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	f := NewHTTPFetcher("millipedes", RetryPolicy{})
+	resp, err := f.Fetch(ts.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "<html></html>" {
+		t.Errorf("unexpected body %q", b)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Size != int64(len(b)) || resp.ContentType != "text/html; charset=utf-8" || resp.Latency <= 0 {
+		t.Errorf("unexpected response metadata %+v", resp)
+	}
+	if resp.Timings.Connect <= 0 || resp.Timings.TTFB <= 0 {
+		t.Errorf("expecting the connection and TTFB to be timed, got %+v", resp.Timings)
+	}
+
+	resp, err = f.Fetch(ts.URL + "/old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirects := []Redirect{{ts.URL + "/old", ts.URL + "/moved", http.StatusMovedPermanently}, {ts.URL + "/moved", ts.URL + "/", http.StatusFound}}
+	if resp.URL != ts.URL+"/old" || resp.FinalURL != ts.URL+"/" || !reflect.DeepEqual(resp.Redirects, redirects) {
+		t.Errorf("expecting redirects %v to %s/, got %v to %s", redirects, ts.URL, resp.Redirects, resp.FinalURL)
+	}
+
+	resp, err = f.Fetch(ts.URL + "/empty")
+	if err != nil || resp.StatusCode != http.StatusNoContent || resp.Size != 0 {
+		t.Errorf("expecting a 204 response to be a success, got %+v and %v", resp, err)
+	}
+
+	tt := []struct {
+		path       string
+		status     int
+		retryAfter time.Duration
+	}{
+		{"/busy", http.StatusTooManyRequests, 120 * time.Second},
+		{"/nothere", http.StatusNotFound, 0},
+	}
+	_, err = f.Fetch(ts.URL + "/loop")
+	fe, ok := err.(*Error)
+	if !ok || fe.Kind != KindRedirect || len(fe.Redirects) != 2 || fe.Redirects[1].To != ts.URL+"/loop" {
+		t.Errorf("expecting a redirect loop through 2 hops, got %#v", err)
+	}
+
+	for _, tc := range tt {
+		_, err = f.Fetch(ts.URL + tc.path)
+		se, ok := err.(*Error)
+		if !ok || se.Kind != KindStatus {
+			t.Errorf("expecting a status error fetching %s, got %v", tc.path, err)
+			continue
+		}
+		if se.StatusCode != tc.status || se.RetryAfter != tc.retryAfter {
+			t.Errorf("expecting status %d and Retry-After %s fetching %s, got %d and %s", tc.status, tc.retryAfter, tc.path, se.StatusCode, se.RetryAfter)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tt := []struct {
+		value string
+		delay time.Duration
+	}{
+		{"", 0},
+		{"30", 30 * time.Second},
+		{"-1", 0},
+		{"Tue, 01 Jan 2019 12:01:00 GMT", time.Minute},
+		{"Tue, 01 Jan 2019 11:00:00 GMT", 0},
+		{"soon", 0},
+	}
+
+	for _, tc := range tt {
+		delay := parseRetryAfter(tc.value, now)
+		if delay != tc.delay {
+			t.Errorf("expecting Retry-After %q to be %s, got %s", tc.value, tc.delay, delay)
+		}
+	}
+}
+
+func TestFetchRetry(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		switch r.URL.Path {
+		case "/flaky":
+			if n < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Write([]byte("<html></html>"))
+		case "/later":
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	tt := []struct {
+		path     string
+		err      bool
+		requests int32
+	}{
+		{"/flaky", false, 3},
+		{"/error", true, 3},
+		{"/later", true, 1},
+		{"/nothere", true, 1},
+	}
+
+	f := NewHTTPFetcher("millipedes", RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond})
+	for _, tc := range tt {
+		atomic.StoreInt32(&requests, 0)
+		_, err := f.Fetch(ts.URL + tc.path)
+		if (err != nil) != tc.err {
+			t.Errorf("unexpected error fetching %s: %v", tc.path, err)
+		}
+		if n := atomic.LoadInt32(&requests); n != tc.requests {
+			t.Errorf("expecting %d requests for %s, got %d", tc.requests, tc.path, n)
+		}
+		if fe, ok := err.(*Error); ok && int32(fe.Attempts) != tc.requests {
+			t.Errorf("expecting %d attempts for %s, got %d", tc.requests, tc.path, fe.Attempts)
+		}
+	}
+}
+
+func TestFetchContext(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	f := NewHTTPFetcher("millipedes", RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := f.FetchContext(ctx, ts.URL)
+	// the retry is scheduled in 5s, but the context is done before
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expecting the retry not to be waited once the context is done, waited %s", elapsed)
+	}
+	if fe, ok := err.(*Error); !ok || fe.StatusCode != http.StatusServiceUnavailable || fe.Attempts != 1 {
+		t.Errorf("expecting the error of the first attempt, got %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expecting a single request, got %d", n)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tt := []struct {
+		err       error
+		kind      Kind
+		retryable bool
+	}{
+		{&net.DNSError{Err: "no such host", Name: "nothere.example.com"}, KindDNS, false},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, KindNetwork, true},
+		{&net.OpError{Op: "read", Err: timeoutError{}}, KindTimeout, true},
+		{tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}, KindTLS, false},
+		{x509.UnknownAuthorityError{}, KindTLS, false},
+	}
+
+	for _, tc := range tt {
+		err := classify("https://example.com", tc.err)
+		if err.Kind != tc.kind || err.Retryable() != tc.retryable {
+			t.Errorf("expecting %v to be %q (retryable %t), got %q (retryable %t)", tc.err, tc.kind, tc.retryable, err.Kind, err.Retryable())
+		}
+	}
+}
+
+// timeoutError is a net.Error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	retryable := &Error{Kind: KindTimeout}
+
+	for attempt, max := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond} {
+		delay, ok := p.backoff(attempt+1, retryable)
+		if !ok || delay < 0 || delay > max {
+			t.Errorf("expecting a delay up to %s after attempt %d, got %s (%t)", max, attempt+1, delay, ok)
+		}
+	}
+	if _, ok := p.backoff(5, retryable); ok {
+		t.Error("expecting no retry after the last attempt")
+	}
+	if _, ok := p.backoff(1, &Error{Kind: KindStatus, StatusCode: http.StatusNotFound}); ok {
+		t.Error("expecting no retry after a 404")
+	}
+	delay, ok := p.backoff(1, &Error{Kind: KindStatus, StatusCode: http.StatusTooManyRequests, RetryAfter: 500 * time.Millisecond})
+	if !ok || delay != 500*time.Millisecond {
+		t.Errorf("expecting a retry after 500ms as requested by Retry-After, got %s (%t)", delay, ok)
+	}
+}
+
+func TestFetchContentType(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "application/xhtml+xml")
+			w.Write([]byte("<html></html>"))
+		case "/sniffed":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte("<!DOCTYPE html><html></html>"))
+		case "/report.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Header().Set("Content-Length", "2048")
+			w.Write(make([]byte, 2048))
+		case "/big":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write(make([]byte, 2048))
+		case "/chunked":
+			w.Header().Set("Content-Type", "text/html")
+			for i := 0; i < 4; i++ {
+				w.Write(make([]byte, 512))
+				w.(http.Flusher).Flush()
+			}
+		}
+	}))
+	defer ts.Close()
+
+	tt := []struct {
+		path        string
+		contentType string
+		html        bool
+		size        int64
+		body        int
+		kind        Kind
+	}{
+		{"/page", "application/xhtml+xml", true, 13, 13, ""},
+		{"/sniffed", "text/html; charset=utf-8", true, 28, 28, ""},
+		{"/report.pdf", "application/pdf", false, 2048, 0, ""},
+		{"/big", "", false, 0, 0, KindTooLarge},
+		{"/chunked", "", false, 0, 0, KindTooLarge},
+	}
+
+	f := NewHTTPFetcher("millipedes", RetryPolicy{}, WithMaxBodySize(1024))
+	for _, tc := range tt {
+		resp, err := f.Fetch(ts.URL + tc.path)
+		if tc.kind != "" {
+			if KindOf(err) != tc.kind {
+				t.Errorf("expecting a %q error fetching %s, got %v", tc.kind, tc.path, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error fetching %s: %s", tc.path, err)
+			continue
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		if resp.ContentType != tc.contentType || resp.IsHTML() != tc.html || resp.Size != tc.size || len(b) != tc.body {
+			t.Errorf("expecting %s to be %s (html %t) of %d bytes with %d read, got %s (html %t) of %d bytes with %d read",
+				tc.path, tc.contentType, tc.html, tc.size, tc.body, resp.ContentType, resp.IsHTML(), resp.Size, len(b))
+		}
+	}
+}
+
+func TestHead(t *testing.T) {
+	var gets int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			atomic.AddInt32(&gets, 1)
+		}
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Content-Length", "1000")
+			w.WriteHeader(http.StatusOK)
+		case "/old":
+			http.Redirect(w, r, "/", http.StatusMovedPermanently)
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Write([]byte("<html></html>"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	f := NewHTTPFetcher("millipedes", RetryPolicy{}, WithMaxBodySize(100))
+	tt := []struct {
+		path  string
+		final string
+		kind  Kind
+		gets  int32
+	}{
+		// the Content-Length is bigger than the maximum body size, which isn't downloaded
+		{path: "/", final: "/"},
+		{path: "/old", final: "/"},
+		{path: "/no-head", final: "/no-head", gets: 1},
+		{path: "/missing", kind: KindStatus},
+	}
+	for _, tc := range tt {
+		atomic.StoreInt32(&gets, 0)
+		resp, err := f.Head(ts.URL + tc.path)
+		if tc.kind != "" {
+			if KindOf(err) != tc.kind {
+				t.Errorf("%s: expecting a %q error, got %v", tc.path, tc.kind, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", tc.path, err)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK || resp.FinalURL != ts.URL+tc.final {
+			t.Errorf("%s: unexpected response %+v", tc.path, resp)
+		}
+		if n := atomic.LoadInt32(&gets); n != tc.gets {
+			t.Errorf("%s: expecting %d GET requests, got %d", tc.path, tc.gets, n)
+		}
+	}
+}
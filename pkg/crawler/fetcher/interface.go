@@ -1,8 +1,18 @@
 package fetcher
 
-import "io"
+import "context"
 
 // Fetcher is the interface to abstract the fetch of a url
 type Fetcher interface {
-	Fetch(url string) (io.Reader, error)
+	Fetch(url string) (*Response, error)
+}
+
+// Checker is the interface of the fetchers which can check a url without downloading it
+type Checker interface {
+	Head(url string) (*Response, error)
+}
+
+// ContextFetcher is the interface of the fetchers which can stop retrying a url once a context is done
+type ContextFetcher interface {
+	FetchContext(ctx context.Context, url string) (*Response, error)
 }
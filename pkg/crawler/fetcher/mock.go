@@ -2,25 +2,67 @@ package fetcher
 
 import (
 	"bytes"
-	"fmt"
-	"io"
+	"net/http"
 )
 
 // MockFetcher mocks a fetcher
 type MockFetcher struct {
-	websites map[string][]byte
+	websites  map[string][]byte
+	redirects map[string]Redirect
 }
 
 // NewMockFetcher returns a new MockFetcher
 func NewMockFetcher(websites map[string][]byte) *MockFetcher {
-	return &MockFetcher{websites: websites}
+	return &MockFetcher{websites: websites, redirects: make(map[string]Redirect, 0)}
 }
 
-// Fetch returns fake data
-func (f *MockFetcher) Fetch(url string) (io.Reader, error) {
-	body, ok := f.websites[url]
+// AddRedirect makes a URL redirect to another one with the given status code
+func (f *MockFetcher) AddRedirect(from, to string, statusCode int) {
+	f.redirects[from] = Redirect{URL: from, To: to, StatusCode: statusCode}
+}
+
+// Fetch returns fake data, with the content type sniffed from it
+func (f *MockFetcher) Fetch(url string) (*Response, error) {
+	final := url
+	var redirects []Redirect
+	for {
+		r, ok := f.redirects[final]
+		if !ok {
+			break
+		}
+		redirects = append(redirects, r)
+		for _, hop := range redirects {
+			if hop.URL == r.To {
+				return nil, &Error{URL: url, Kind: KindRedirect, Attempts: 1, Redirects: redirects, Err: errRedirectLoop}
+			}
+		}
+		final = r.To
+	}
+
+	body, ok := f.websites[final]
 	if !ok {
-		return nil, fmt.Errorf("not found")
+		return nil, &Error{URL: url, Kind: KindStatus, StatusCode: http.StatusNotFound, Attempts: 1, Redirects: redirects}
+	}
+	header := http.Header{}
+	header.Set("Content-Type", http.DetectContentType(body))
+	return &Response{
+		URL:         url,
+		FinalURL:    final,
+		StatusCode:  http.StatusOK,
+		Redirects:   redirects,
+		Header:      header,
+		ContentType: header.Get("Content-Type"),
+		Size:        int64(len(body)),
+		Body:        bytes.NewReader(body),
+	}, nil
+}
+
+// Head returns fake data like Fetch, with an empty body
+func (f *MockFetcher) Head(url string) (*Response, error) {
+	resp, err := f.Fetch(url)
+	if err != nil {
+		return nil, err
 	}
-	return bytes.NewReader(body), nil
+	resp.Body = bytes.NewReader(nil)
+	return resp, nil
 }
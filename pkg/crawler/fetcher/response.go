@@ -0,0 +1,54 @@
+package fetcher
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// Response is the result of fetching a URL
+type Response struct {
+	// URL is the requested URL
+	URL string
+	// FinalURL is the URL the body was read from, after following the redirects
+	FinalURL string
+	// StatusCode is the status code of the final response
+	StatusCode int
+	// Redirects is the chain of redirects followed from URL to FinalURL, in order
+	Redirects []Redirect
+	Header    http.Header
+	// ContentType is the value of the Content-Type header, or the sniffed one if the server didn't send it
+	ContentType string
+	// Size is the size of the body in bytes, or its Content-Length if the body wasn't read
+	Size int64
+	// Latency is the time spent fetching the URL, from the first request to the end of the body
+	Latency time.Duration
+	Timings Timings
+	// Body is the content of HTML and plain text responses, other bodies aren't downloaded and are empty
+	Body io.Reader
+}
+
+// IsHTML returns true if the response is a HTML or XHTML page
+func (r *Response) IsHTML() bool {
+	return IsHTML(r.ContentType)
+}
+
+// Redirect is a hop of a redirect chain
+type Redirect struct {
+	// URL is the URL that replied with the redirect
+	URL string
+	// To is the URL the redirect points to
+	To string
+	// StatusCode is the status code of the redirect, e.g. 301
+	StatusCode int
+}
+
+// Timings holds the duration of the phases of the last request sent to fetch a URL.
+// Phases that didn't happen, e.g. DNS and TLS on a reused connection, are 0.
+type Timings struct {
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	// TTFB is the time to first byte, from the start of the request to the first byte of the response
+	TTFB time.Duration
+}
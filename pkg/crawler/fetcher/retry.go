@@ -0,0 +1,51 @@
+package fetcher
+
+import (
+	"math/rand"
+	"time"
+)
+
+// DefaultRetryPolicy is the retry policy used by the crawler unless configured otherwise
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+}
+
+// RetryPolicy configures how requests failing with a retryable error are sent again
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of requests sent for a URL, 0 or 1 meaning no retries
+	MaxAttempts int
+	// BaseDelay is the maximum wait before the first retry, doubled at every following attempt
+	BaseDelay time.Duration
+	// MaxDelay caps the wait between two attempts. A server asking to retry later than
+	// MaxDelay with Retry-After isn't retried.
+	MaxDelay time.Duration
+}
+
+// backoff returns how long to wait after the given failed attempt (starting from 1) before
+// retrying, and false if the request shouldn't be retried. The wait is picked at random
+// between 0 and the exponential delay, so that failing requests don't retry in lockstep.
+func (p RetryPolicy) backoff(attempt int, err *Error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts || !err.Retryable() {
+		return 0, false
+	}
+	if err.RetryAfter > 0 {
+		if p.MaxDelay > 0 && err.RetryAfter > p.MaxDelay {
+			return 0, false
+		}
+		return err.RetryAfter, true
+	}
+
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0, true
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1)), true
+}
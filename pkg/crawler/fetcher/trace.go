@@ -0,0 +1,102 @@
+package fetcher
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// tracer records the redirects and the timings of a request
+type tracer struct {
+	redirects    []Redirect
+	timings      Timings
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	mux          *sync.Mutex
+}
+
+type tracerKey struct{}
+
+// newTracer returns a tracer and a context tracing the requests made with it
+func newTracer(ctx context.Context) (*tracer, context.Context) {
+	t := &tracer{mux: &sync.Mutex{}}
+	trace := &httptrace.ClientTrace{
+		GetConn: func(string) {
+			t.mux.Lock()
+			// a new request is being sent, either the first one or a redirect
+			t.start = time.Now()
+			t.timings = Timings{}
+			t.mux.Unlock()
+		},
+		DNSStart:             func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { t.since(&t.dnsStart, &t.timings.DNS) },
+		ConnectStart:         func(string, string) { t.mark(&t.connectStart) },
+		ConnectDone:          func(string, string, error) { t.since(&t.connectStart, &t.timings.Connect) },
+		TLSHandshakeStart:    func() { t.mark(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.since(&t.tlsStart, &t.timings.TLS) },
+		GotFirstResponseByte: func() { t.since(&t.start, &t.timings.TTFB) },
+	}
+	ctx = context.WithValue(ctx, tracerKey{}, t)
+	return t, httptrace.WithClientTrace(ctx, trace)
+}
+
+// mark records the current time
+func (t *tracer) mark(at *time.Time) {
+	t.mux.Lock()
+	*at = time.Now()
+	t.mux.Unlock()
+}
+
+// since records the time elapsed since start
+func (t *tracer) since(start *time.Time, d *time.Duration) {
+	t.mux.Lock()
+	*d = time.Since(*start)
+	t.mux.Unlock()
+}
+
+// getTimings returns the timings of the last request
+func (t *tracer) getTimings() Timings {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	return t.timings
+}
+
+// maxRedirects is the number of redirects followed before giving up, like the default policy of http.Client
+const maxRedirects = 10
+
+var (
+	errRedirectLoop     = errors.New("redirect loop")
+	errTooManyRedirects = fmt.Errorf("stopped after %d redirects", maxRedirects)
+)
+
+// checkRedirect records the redirects followed by the HTTP client, stopping at loops and after maxRedirects
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if t, ok := req.Context().Value(tracerKey{}).(*tracer); ok && req.Response != nil {
+		t.mux.Lock()
+		t.redirects = append(t.redirects, Redirect{URL: via[len(via)-1].URL.String(), To: req.URL.String(), StatusCode: req.Response.StatusCode})
+		t.mux.Unlock()
+	}
+	for _, r := range via {
+		if r.URL.String() == req.URL.String() {
+			return errRedirectLoop
+		}
+	}
+	if len(via) >= maxRedirects {
+		return errTooManyRedirects
+	}
+	return nil
+}
+
+// getRedirects returns the redirects followed so far
+func (t *tracer) getRedirects() []Redirect {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	return t.redirects
+}
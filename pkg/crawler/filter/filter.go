@@ -0,0 +1,144 @@
+package filter
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	kindRegexp = "re"
+	kindGlob   = "glob"
+	kindPrefix = "prefix"
+)
+
+// Rule matches a URL by regular expression or glob on its path and query, or by path prefix
+type Rule struct {
+	kind    string
+	pattern string
+	re      *regexp.Regexp
+}
+
+// globToRegexp converts a glob to a regular expression: ** matches any sequence of
+// characters, * matches any sequence of characters except / and the rest is literal
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// ParseRule parses a rule in the form kind:pattern where kind is re, glob or prefix.
+// A pattern without kind is treated as a glob.
+func ParseRule(s string) (Rule, error) {
+	kind, pattern := kindGlob, s
+	if kv := strings.SplitN(s, ":", 2); len(kv) == 2 {
+		switch kv[0] {
+		case kindRegexp, kindGlob, kindPrefix:
+			kind, pattern = kv[0], kv[1]
+		}
+	}
+	if pattern == "" {
+		return Rule{}, fmt.Errorf("empty pattern in rule %q", s)
+	}
+
+	r := Rule{kind: kind, pattern: pattern}
+	var err error
+	switch kind {
+	case kindRegexp:
+		r.re, err = regexp.Compile(pattern)
+	case kindGlob:
+		r.re, err = regexp.Compile(globToRegexp(pattern))
+	}
+	if err != nil {
+		return Rule{}, fmt.Errorf("invalid rule %q: %s", s, err)
+	}
+	return r, nil
+}
+
+// Match returns true if the URL matches the rule
+func (r Rule) Match(u *url.URL) bool {
+	if r.kind == kindPrefix {
+		path := u.Path
+		if path == "" {
+			path = "/"
+		}
+		return strings.HasPrefix(path, r.pattern)
+	}
+
+	target := u.EscapedPath()
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	return r.re.MatchString(target)
+}
+
+// String returns the rule in the same form accepted by ParseRule
+func (r Rule) String() string {
+	return fmt.Sprintf("%s:%s", r.kind, r.pattern)
+}
+
+// Filter decides which URLs can be crawled. When include rules are set a URL must match
+// at least one of them, and it must never match an exclude rule.
+type Filter struct {
+	include []Rule
+	exclude []Rule
+}
+
+// New returns a new Filter parsing include and exclude rules
+func New(include, exclude []string) (*Filter, error) {
+	f := &Filter{
+		include: make([]Rule, 0, len(include)),
+		exclude: make([]Rule, 0, len(exclude)),
+	}
+	for _, s := range include {
+		r, err := ParseRule(s)
+		if err != nil {
+			return nil, err
+		}
+		f.include = append(f.include, r)
+	}
+	for _, s := range exclude {
+		r, err := ParseRule(s)
+		if err != nil {
+			return nil, err
+		}
+		f.exclude = append(f.exclude, r)
+	}
+	return f, nil
+}
+
+// Allowed returns true if the URL passes the include and exclude rules
+func (f *Filter) Allowed(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+
+	for _, r := range f.exclude {
+		if r.Match(u) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, r := range f.include {
+		if r.Match(u) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package filter
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	tt := []struct {
+		rule string
+		str  string
+		ok   bool
+	}{
+		{"re:\\.pdf$", "re:\\.pdf$", true},
+		{"glob:/docs/*", "glob:/docs/*", true},
+		{"prefix:/docs/", "prefix:/docs/", true},
+		{"/blog/**", "glob:/blog/**", true},
+		{"re:(", "", false},
+		{"prefix:", "", false},
+	}
+
+	for _, tc := range tt {
+		r, err := ParseRule(tc.rule)
+		if (err == nil) != tc.ok {
+			t.Errorf("expecting parsing %q to succeed %v, got error %v", tc.rule, tc.ok, err)
+			continue
+		}
+		if tc.ok && r.String() != tc.str {
+			t.Errorf("expecting rule %q to be parsed as %q, got %q", tc.rule, tc.str, r.String())
+		}
+	}
+}
+
+func TestRuleMatch(t *testing.T) {
+	tt := []struct {
+		rule  string
+		uri   string
+		match bool
+	}{
+		{"re:\\.pdf$", "https://example.com/files/doc.pdf", true},
+		{"re:\\.pdf$", "https://example.com/files/doc.html", false},
+		{"re:[?&]page=", "https://example.com/blog?page=2", true},
+		{"glob:/docs/*", "https://example.com/docs/intro", true},
+		{"glob:/docs/*", "https://example.com/docs/intro/setup", false},
+		{"glob:/docs/**", "https://example.com/docs/intro/setup", true},
+		{"glob:/search?**", "https://example.com/search?q=test", true},
+		{"glob:/search?**", "https://example.com/search", false},
+		{"prefix:/docs/", "https://example.com/docs/intro", true},
+		{"prefix:/docs/", "https://example.com/documents", false},
+		{"prefix:/", "https://example.com", true},
+	}
+
+	for _, tc := range tt {
+		r, err := ParseRule(tc.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := url.Parse(tc.uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Match(u) != tc.match {
+			t.Errorf("expecting %s to match %s %v", tc.rule, tc.uri, tc.match)
+		}
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	f, err := New([]string{"prefix:/docs/", "prefix:/blog/"}, []string{"re:\\.pdf$", "glob:/blog/drafts/**"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		uri     string
+		allowed bool
+	}{
+		{"https://example.com/docs/intro", true},
+		{"https://example.com/docs/manual.pdf", false},
+		{"https://example.com/blog/post", true},
+		{"https://example.com/blog/drafts/post", false},
+		{"https://example.com/careers", false},
+	}
+
+	for _, tc := range tt {
+		if f.Allowed(tc.uri) != tc.allowed {
+			t.Errorf("expecting %s allowed to be %v", tc.uri, tc.allowed)
+		}
+	}
+
+	// with no include rules everything that isn't excluded is allowed
+	f, err = New(nil, []string{"re:\\.pdf$"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Allowed("https://example.com/careers") {
+		t.Error("expecting https://example.com/careers to be allowed without include rules")
+	}
+}
@@ -0,0 +1,66 @@
+package frontier
+
+import "sync"
+
+// BoundedFrontier is an in-memory FIFO frontier with a maximum capacity. Pushing to a
+// full frontier fails with ErrFull instead of blocking.
+type BoundedFrontier struct {
+	items    []Item
+	capacity int
+	closed   bool
+	mux      *sync.Mutex
+}
+
+// NewBoundedFrontier returns a new BoundedFrontier holding at most capacity items
+func NewBoundedFrontier(capacity int) *BoundedFrontier {
+	return &BoundedFrontier{
+		items:    make([]Item, 0),
+		capacity: capacity,
+		mux:      &sync.Mutex{},
+	}
+}
+
+// Push adds an item to the frontier
+func (f *BoundedFrontier) Push(item Item) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if f.closed {
+		return ErrClosed
+	}
+	if len(f.items) >= f.capacity {
+		return ErrFull
+	}
+	f.items = append(f.items, item)
+	return nil
+}
+
+// Pop removes and returns the oldest item of the frontier
+func (f *BoundedFrontier) Pop() (Item, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if f.closed {
+		return Item{}, ErrClosed
+	}
+	if len(f.items) == 0 {
+		return Item{}, ErrEmpty
+	}
+	item := f.items[0]
+	f.items = f.items[1:]
+	return item, nil
+}
+
+// Len returns the number of items in the frontier
+func (f *BoundedFrontier) Len() int {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return len(f.items)
+}
+
+// Close discards the items left in the frontier
+func (f *BoundedFrontier) Close() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.closed = true
+	f.items = nil
+	return nil
+}
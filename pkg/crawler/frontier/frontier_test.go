@@ -0,0 +1,103 @@
+package frontier
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSpillFrontier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frontier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := NewSpillFrontier(2, dir)
+	if _, err := f.Pop(); err != ErrEmpty {
+		t.Errorf("expecting %s on an empty frontier, got %v", ErrEmpty, err)
+	}
+
+	// push more items than the threshold, interleaving pops, and expect FIFO order
+	for i := 0; i < 5; i++ {
+		if err := f.Push(Item{URL: fmt.Sprintf("https://example.com/%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f.Len() != 5 {
+		t.Errorf("expecting 5 items in the frontier, got %d", f.Len())
+	}
+	if f.file == nil {
+		t.Fatal("expecting items past the threshold to be spilled to disk")
+	}
+
+	next := 0
+	pop := func() {
+		item, err := f.Pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := fmt.Sprintf("https://example.com/%d", next)
+		if item.URL != expected {
+			t.Errorf("expecting %s, got %s", expected, item.URL)
+		}
+		next++
+	}
+	pop()
+	pop()
+	pop()
+	if err := f.Push(Item{URL: "https://example.com/5"}); err != nil {
+		t.Fatal(err)
+	}
+	pop()
+	pop()
+	pop()
+	if f.Len() != 0 {
+		t.Errorf("expecting the frontier to be empty, got %d items", f.Len())
+	}
+	if f.writeOff != 0 {
+		t.Errorf("expecting the spill file to be truncated once drained")
+	}
+
+	name := f.file.Name()
+	if err := f.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("expecting the spill file to be removed on close")
+	}
+	if err := f.Push(Item{URL: "https://example.com"}); err != ErrClosed {
+		t.Errorf("expecting %s pushing to a closed frontier, got %v", ErrClosed, err)
+	}
+}
+
+func TestBoundedFrontier(t *testing.T) {
+	f := NewBoundedFrontier(2)
+
+	tt := []struct {
+		url string
+		err error
+	}{
+		{"https://example.com/a", nil},
+		{"https://example.com/b", nil},
+		{"https://example.com/c", ErrFull},
+	}
+	for _, tc := range tt {
+		err := f.Push(Item{URL: tc.url})
+		if err != tc.err {
+			t.Errorf("expecting pushing %s to return %v, got %v", tc.url, tc.err, err)
+		}
+	}
+
+	item, err := f.Pop()
+	if err != nil || item.URL != "https://example.com/a" {
+		t.Errorf("expecting https://example.com/a, got %s (%v)", item.URL, err)
+	}
+	if err := f.Push(Item{URL: "https://example.com/c"}); err != nil {
+		t.Errorf("expecting a free slot after popping, got %s", err)
+	}
+	if f.Len() != 2 {
+		t.Errorf("expecting 2 items in the frontier, got %d", f.Len())
+	}
+}
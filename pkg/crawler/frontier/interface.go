@@ -0,0 +1,28 @@
+package frontier
+
+import "errors"
+
+var (
+	// ErrEmpty is returned by Pop when there are no items in the frontier
+	ErrEmpty = errors.New("frontier is empty")
+	// ErrFull is returned by Push when a bounded frontier reached its capacity
+	ErrFull = errors.New("frontier is full")
+	// ErrClosed is returned when using a frontier that has been closed
+	ErrClosed = errors.New("frontier is closed")
+)
+
+// Item is a URL waiting to be crawled
+type Item struct {
+	URL string `json:"url"`
+	// Depth is the number of links followed from the entrypoint to reach the URL
+	Depth int `json:"depth"`
+}
+
+// Frontier is the interface of the queue of URLs that need to be crawled.
+// Implementations must be safe for concurrent use and Push must never block.
+type Frontier interface {
+	Push(item Item) error
+	Pop() (Item, error)
+	Len() int
+	Close() error
+}
@@ -0,0 +1,146 @@
+package frontier
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// SpillFrontier is a FIFO frontier that keeps up to threshold items in memory and spills
+// the rest to a temporary file, so that pushing never blocks regardless of its size.
+type SpillFrontier struct {
+	mem       []Item
+	threshold int
+	dir       string
+	file      *os.File
+	readOff   int64
+	writeOff  int64
+	onDisk    int
+	closed    bool
+	mux       *sync.Mutex
+}
+
+// NewSpillFrontier returns a new SpillFrontier. The spill file is created in dir, or in the
+// default temporary directory if dir is empty, only once the threshold is exceeded.
+func NewSpillFrontier(threshold int, dir string) *SpillFrontier {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &SpillFrontier{
+		mem:       make([]Item, 0),
+		threshold: threshold,
+		dir:       dir,
+		mux:       &sync.Mutex{},
+	}
+}
+
+// Push adds an item to the frontier. Once items are on disk new ones are spilled too
+// so that the order is preserved.
+func (f *SpillFrontier) Push(item Item) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if f.closed {
+		return ErrClosed
+	}
+	if f.onDisk == 0 && len(f.mem) < f.threshold {
+		f.mem = append(f.mem, item)
+		return nil
+	}
+	return f.spill(item)
+}
+
+// spill appends an item to the spill file, one JSON document per line
+func (f *SpillFrontier) spill(item Item) error {
+	if f.file == nil {
+		file, err := ioutil.TempFile(f.dir, "millipedes-frontier-")
+		if err != nil {
+			return fmt.Errorf("error creating spill file: %s", err)
+		}
+		f.file = file
+	}
+
+	b, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	n, err := f.file.WriteAt(b, f.writeOff)
+	if err != nil {
+		return fmt.Errorf("error spilling %s: %s", item.URL, err)
+	}
+	f.writeOff += int64(n)
+	f.onDisk++
+	return nil
+}
+
+// load moves up to threshold items from the spill file back into memory. Once the
+// file has been fully read it's truncated to reclaim space.
+func (f *SpillFrontier) load() error {
+	r := bufio.NewReader(io.NewSectionReader(f.file, f.readOff, f.writeOff-f.readOff))
+	for len(f.mem) < f.threshold && f.onDisk > 0 {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return fmt.Errorf("error reading spill file: %s", err)
+		}
+		var item Item
+		if err := json.Unmarshal(line, &item); err != nil {
+			return fmt.Errorf("error decoding spilled item: %s", err)
+		}
+		f.readOff += int64(len(line))
+		f.onDisk--
+		f.mem = append(f.mem, item)
+	}
+
+	if f.onDisk == 0 {
+		f.readOff, f.writeOff = 0, 0
+		return f.file.Truncate(0)
+	}
+	return nil
+}
+
+// Pop removes and returns the oldest item of the frontier
+func (f *SpillFrontier) Pop() (Item, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if f.closed {
+		return Item{}, ErrClosed
+	}
+	if len(f.mem) == 0 && f.onDisk > 0 {
+		if err := f.load(); err != nil {
+			return Item{}, err
+		}
+	}
+	if len(f.mem) == 0 {
+		return Item{}, ErrEmpty
+	}
+	item := f.mem[0]
+	f.mem = f.mem[1:]
+	return item, nil
+}
+
+// Len returns the number of items in the frontier, both in memory and on disk
+func (f *SpillFrontier) Len() int {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return len(f.mem) + f.onDisk
+}
+
+// Close discards the items left in the frontier and removes the spill file
+func (f *SpillFrontier) Close() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	f.mem = nil
+	if f.file == nil {
+		return nil
+	}
+	f.file.Close()
+	return os.Remove(f.file.Name())
+}
@@ -0,0 +1,135 @@
+package normalizer
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// DefaultTrackingParams are the query parameters commonly used to track visits, which don't change the content of a page
+var DefaultTrackingParams = []string{"utm_*", "gclid", "fbclid", "msclkid", "mc_cid", "mc_eid", "yclid", "_ga"}
+
+// Normalizer canonicalizes URLs so that equivalent URLs are crawled and stored only once
+type Normalizer struct {
+	trackingParams     []string
+	stripTrailingSlash bool
+}
+
+// New returns a new Normalizer removing the given tracking parameters from the query, where a
+// trailing * matches any suffix (e.g. utm_*). If stripTrailingSlash is true /about/ and /about
+// are considered the same URL.
+func New(trackingParams []string, stripTrailingSlash bool) *Normalizer {
+	return &Normalizer{
+		trackingParams:     trackingParams,
+		stripTrailingSlash: stripTrailingSlash,
+	}
+}
+
+// isTrackingParam checks if a query parameter is in the tracking parameters list
+func (n *Normalizer) isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	for _, p := range n.trackingParams {
+		p = strings.ToLower(p)
+		if strings.HasSuffix(p, "*") && strings.HasPrefix(key, strings.TrimSuffix(p, "*")) {
+			return true
+		}
+		if key == p {
+			return true
+		}
+	}
+	return false
+}
+
+// normaliseQuery removes tracking parameters and sorts the others, keeping their original encoding
+func (n *Normalizer) normaliseQuery(rawQuery string) string {
+	params := make([]string, 0)
+	for _, p := range strings.Split(rawQuery, "&") {
+		if p == "" {
+			continue
+		}
+		key := strings.SplitN(p, "=", 2)[0]
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if n.isTrackingParam(key) {
+			continue
+		}
+		params = append(params, p)
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// removeDotSegments resolves . and .. segments of a path, as described in RFC 3986
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+	segments := strings.Split(path, "/")
+	out := make([]string, 0, len(segments))
+	for i, s := range segments {
+		switch s {
+		case ".":
+		case "..":
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+		default:
+			out = append(out, s)
+			continue
+		}
+		// a trailing dot segment refers to a directory
+		if i == len(segments)-1 {
+			out = append(out, "")
+		}
+	}
+	return strings.Join(out, "/")
+}
+
+// Normalize returns the canonical form of an absolute URL: the fragment is removed, scheme and
+// host are lowercased, default ports are removed, dot segments are resolved, tracking parameters
+// are removed and the query is sorted. URLs without a host, like mailto:, are only lowercased.
+func (n *Normalizer) Normalize(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.Opaque != "" || u.Host == "" {
+		return u.String(), nil
+	}
+
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		// IPv6 literal
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+
+	path := removeDotSegments(u.EscapedPath())
+	if path == "" {
+		path = "/"
+	}
+	if n.stripTrailingSlash && path != "/" {
+		path = strings.TrimRight(path, "/")
+	}
+	u.Path, err = url.PathUnescape(path)
+	if err != nil {
+		return "", err
+	}
+	u.RawPath = path
+
+	u.RawQuery = n.normaliseQuery(u.RawQuery)
+	u.ForceQuery = false
+	return u.String(), nil
+}
@@ -0,0 +1,68 @@
+package normalizer
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	n := New(DefaultTrackingParams, false)
+
+	tt := []struct {
+		in  string
+		out string
+	}{
+		{"https://example.com", "https://example.com/"},
+		{"https://example.com/", "https://example.com/"},
+		{"https://EXAMPLE.com/#top", "https://example.com/"},
+		{"HTTPS://Example.COM/About", "https://example.com/About"},
+		{"https://example.com/?utm_source=x", "https://example.com/"},
+		{"https://example.com/?utm_source=x&utm_medium=y&page=2", "https://example.com/?page=2"},
+		{"https://example.com/?b=2&a=1&fbclid=abc", "https://example.com/?a=1&b=2"},
+		{"https://example.com/?", "https://example.com/"},
+		{"https://example.com:443/a", "https://example.com/a"},
+		{"http://example.com:80/a", "http://example.com/a"},
+		{"http://example.com:8080/a", "http://example.com:8080/a"},
+		{"https://example.com:80/a", "https://example.com:80/a"},
+		{"https://example.com/a/./b/../c", "https://example.com/a/c"},
+		{"https://example.com/a/b/..", "https://example.com/a/"},
+		{"https://example.com/../../a", "https://example.com/a"},
+		{"https://example.com/a%2Fb/c", "https://example.com/a%2Fb/c"},
+		{"https://example.com/search?q=a+b&lang=en", "https://example.com/search?lang=en&q=a+b"},
+		{"https://[::1]:443/a", "https://[::1]/a"},
+		{"mailto:Info@example.com", "mailto:Info@example.com"},
+	}
+
+	for _, tc := range tt {
+		out, err := n.Normalize(tc.in)
+		if err != nil {
+			t.Errorf("unexpected error normalising %s: %s", tc.in, err)
+			continue
+		}
+		if out != tc.out {
+			t.Errorf("expecting %s to be normalised to %s, got %s", tc.in, tc.out, out)
+		}
+	}
+}
+
+func TestNormalizeTrailingSlash(t *testing.T) {
+	n := New(nil, true)
+
+	tt := []struct {
+		in  string
+		out string
+	}{
+		{"https://example.com", "https://example.com/"},
+		{"https://example.com/about/", "https://example.com/about"},
+		{"https://example.com/about", "https://example.com/about"},
+		{"https://example.com/about/?utm_source=x", "https://example.com/about?utm_source=x"},
+	}
+
+	for _, tc := range tt {
+		out, err := n.Normalize(tc.in)
+		if err != nil {
+			t.Errorf("unexpected error normalising %s: %s", tc.in, err)
+			continue
+		}
+		if out != tc.out {
+			t.Errorf("expecting %s to be normalised to %s, got %s", tc.in, tc.out, out)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+// prescanLen is the number of bytes examined to detect the encoding of a page, as the HTML spec requires
+const prescanLen = 1024
+
+// utf8BOM is the byte order mark of UTF-8 documents
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// decode converts the body of a page to UTF-8 and returns the name of its encoding. The encoding
+// is detected, in order of precedence, from the byte order mark, the charset of the Content-Type
+// and the <meta charset> of the page. Pages not declaring it are assumed to be UTF-8, unless their
+// first bytes aren't valid UTF-8, in which case they're decoded as windows-1252.
+func decode(body io.Reader, contentType string) (io.Reader, string) {
+	r := bufio.NewReaderSize(body, prescanLen)
+	// a short or failed read still returns the bytes to detect the encoding from
+	prefix, _ := r.Peek(prescanLen)
+	e, name, certain := charset.DetermineEncoding(prefix, contentType)
+	if !certain && name == "windows-1252" && isUndeclaredASCII(prefix) {
+		// the spec default, but an ASCII beginning is far more likely to be followed by UTF-8 nowadays
+		return r, "utf-8"
+	}
+	if name == "utf-8" {
+		// the UTF-8 decoder would keep the BOM in the text
+		if bytes.HasPrefix(prefix, utf8BOM) {
+			r.Discard(len(utf8BOM))
+		}
+		return r, name
+	}
+	return e.NewDecoder().Reader(r), name
+}
+
+// isUndeclaredASCII returns true if the beginning of a page is ASCII and has no charset declaration
+func isUndeclaredASCII(prefix []byte) bool {
+	for _, b := range prefix {
+		if b >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return !bytes.Contains(bytes.ToLower(prefix), []byte("charset"))
+}
@@ -1,54 +1,212 @@
 package parser
 
 import (
+	"fmt"
 	"io"
 	"net/url"
+	"strings"
 
+	"github.com/amartorelli/millipedes/pkg/crawler/normalizer"
+	"github.com/amartorelli/millipedes/pkg/crawler/robots"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/net/html"
 )
 
-// normaliseURL converts to absolute paths
-func normaliseURL(base, href string) string {
-	uri, err := url.Parse(href)
+// Parser extracts links from HTML pages
+type Parser struct {
+	normalizer *normalizer.Normalizer
+}
+
+// NewParser returns a new Parser canonicalizing links with the normalizer, if not nil
+func NewParser(n *normalizer.Normalizer) *Parser {
+	return &Parser{normalizer: n}
+}
+
+// Document holds what the parser found in a page
+type Document struct {
+	// Links are the links to other pages or resources, which can be crawled
+	Links []Link
+	// NonNavigable are the links which can't be crawled, e.g. mailto:, tel:, javascript: or data: URLs
+	NonNavigable []Link
+	// Warnings are the problems found parsing the page, e.g. malformed links
+	Warnings []string
+	// Robots are the directives of the <meta name="robots"> tags of the page
+	Robots robots.Directives
+	// Metadata describes the page, e.g. its title and headings
+	Metadata Metadata
+	// Charset is the name of the encoding the page was decoded from, e.g. utf-8 or shift_jis
+	Charset string
+}
+
+// maxNonNavigableLen is the length non-navigable links are shortened to, e.g. data: URLs
+const maxNonNavigableLen = 100
+
+// resolveURL converts a link to an absolute URL
+func resolveURL(base, href string) (*url.URL, error) {
+	uri, err := url.Parse(strings.TrimSpace(href))
 	if err != nil {
-		return ""
+		return nil, err
 	}
 	baseURL, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	return baseURL.ResolveReference(uri), nil
+}
+
+// normaliseURL converts to absolute paths
+func normaliseURL(base, href string) string {
+	uri, err := resolveURL(base, href)
 	if err != nil {
 		return ""
 	}
-	uri = baseURL.ResolveReference(uri)
 	return uri.String()
 }
 
-// getLinkFromToken extracts the link from a HTML <a><href> node
-func getLinkFromToken(t html.Token) (string, bool) {
-	if t.Data == "a" {
-		for _, attr := range t.Attr {
-			if attr.Key == "href" {
-				return attr.Val, true
-			}
-		}
+// isNavigable returns true if a URL can be fetched by the crawler
+func isNavigable(u *url.URL) bool {
+	return u.Scheme == "http" || u.Scheme == "https"
+}
+
+// shorten truncates long links, e.g. data: URLs embedding a whole image
+func shorten(link string) string {
+	if len(link) <= maxNonNavigableLen {
+		return link
+	}
+	return link[:maxNonNavigableLen] + "..."
+}
+
+// getBase extracts the URL from a HTML <base><href> node
+func getBase(n *html.Node) (string, bool) {
+	if n.Data != "base" {
+		return "", false
+	}
+	return getAttr(n, "href")
+}
+
+// getMetaRobots extracts the content of a HTML <meta name="robots"> node
+func getMetaRobots(n *html.Node) (string, bool) {
+	if n.Data != "meta" {
+		return "", false
+	}
+	if name, _ := getAttr(n, "name"); !strings.EqualFold(name, "robots") {
+		return "", false
 	}
-	return "", false
+	return getAttr(n, "content")
 }
 
-// ExtractLinks returns a list of links from the body of a page. It also requires the baseURL so that it can normalise relative links.
+// ExtractLinks returns a list of links from the body of a page without canonicalizing them. It also
+// requires the URL of the page so that it can normalise relative links.
 func ExtractLinks(body io.Reader, base string) []string {
+	return NewParser(nil).ExtractLinks(body, base)
+}
+
+// canonicalize applies the normalizer to an absolute link
+func (p *Parser) canonicalize(link string) string {
+	if p.normalizer == nil || link == "" {
+		return link
+	}
+	canonical, err := p.normalizer.Normalize(link)
+	if err != nil {
+		logrus.Debugf("error normalising %s: %s", link, err)
+		return link
+	}
+	return canonical
+}
+
+// ExtractLinks returns a list of canonical links from the body of a page, whatever their kind.
+// It also requires the URL of the page so that it can normalise relative links.
+func (p *Parser) ExtractLinks(body io.Reader, base string) []string {
 	links := []string{}
-	tokenizer := html.NewTokenizer(body)
-	for {
-		t := tokenizer.Next()
-		switch t {
-		case html.ErrorToken:
-			return links
-		case html.StartTagToken, html.EndTagToken:
-			token := tokenizer.Token()
-			l, found := getLinkFromToken(token)
-			if !found {
-				continue
+	for _, l := range p.Links(body, base) {
+		links = append(links, l.URL)
+	}
+	return links
+}
+
+// Links returns the canonical links found in the body of a page which can be crawled, along with
+// their kind. It also requires the URL of the page so that it can normalise relative links.
+func (p *Parser) Links(body io.Reader, base string) []Link {
+	return p.Parse(body, base).Links
+}
+
+// Parse parses a page and returns its metadata and canonical links, classifying the ones that can't
+// be crawled. It also requires the URL of the page so that it can normalise relative links. As the HTML
+// spec requires, the first <base href> of the document overrides the page URL for all of its links.
+// The encoding of the page is detected from its byte order mark or <meta charset>.
+func (p *Parser) Parse(body io.Reader, base string) *Document {
+	return p.ParseResponse(body, base, "")
+}
+
+// ParseResponse parses a page like Parse, also detecting its encoding from the Content-Type it was
+// served with, which takes precedence over <meta charset>.
+func (p *Parser) ParseResponse(body io.Reader, base, contentType string) *Document {
+	body, name := decode(body, contentType)
+	root, err := html.Parse(body)
+	if err != nil {
+		return &Document{Links: []Link{}, Charset: name, Warnings: []string{fmt.Sprintf("error parsing the page: %s", err)}}
+	}
+
+	found := []Link{}
+	var directives robots.Directives
+	var meta Metadata
+	baseFound := false
+	var walk func(n *html.Node, position Position, inSVG bool)
+	walk = func(n *html.Node, position Position, inSVG bool) {
+		if n.Type == html.ElementNode {
+			inSVG = inSVG || n.Data == "svg"
+			meta.collect(n, inSVG)
+			if b, ok := getBase(n); ok && !baseFound {
+				baseFound = true
+				if resolved := normaliseURL(base, b); resolved != "" {
+					base = resolved
+				}
+			}
+			if content, ok := getMetaRobots(n); ok {
+				directives = directives.Merge(robots.ParseDirectives(content))
 			}
-			links = append(links, normaliseURL(base, l))
+			if landmark, ok := getLandmark(n); ok {
+				position = landmark
+			}
+			for _, l := range getLinks(n) {
+				l.Position = position
+				if l.Kind == KindAnchor || l.Kind == KindArea {
+					l.Text = anchorText(n)
+					l.Title, _ = getAttr(n, "title")
+					l.Rel, _ = getAttr(n, "rel")
+				}
+				found = append(found, l)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, position, inSVG)
+		}
+	}
+	walk(root, "", false)
+
+	meta.WordCount = wordCount(root)
+	if meta.Canonical != "" {
+		meta.Canonical = normaliseURL(base, meta.Canonical)
+	}
+	doc := &Document{Links: make([]Link, 0, len(found)), Robots: directives, Metadata: meta, Charset: name}
+	for _, l := range found {
+		u, err := resolveURL(base, l.URL)
+		if err != nil {
+			if urlErr, ok := err.(*url.Error); ok {
+				err = urlErr.Err
+			}
+			warning := fmt.Sprintf("invalid %s link %q: %s", l.Kind, l.URL, err)
+			logrus.Debug(warning)
+			doc.Warnings = append(doc.Warnings, warning)
+			continue
+		}
+		if !isNavigable(u) {
+			l.URL = shorten(u.String())
+			doc.NonNavigable = append(doc.NonNavigable, l)
+			continue
 		}
+		l.URL = p.canonicalize(u.String())
+		doc.Links = append(doc.Links, l)
 	}
+	return doc
 }
@@ -3,10 +3,14 @@ package parser
 import (
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/amartorelli/millipedes/pkg/crawler/normalizer"
+	"github.com/amartorelli/millipedes/pkg/crawler/robots"
 	"golang.org/x/net/html"
 )
 
@@ -22,6 +26,16 @@ func TestNormaliseURL(t *testing.T) {
 		{"https://www.example.com", "/contact-us.html", "https://www.example.com/contact-us.html"},
 		{"https://www.example.com", "/contact-us.html?page=2", "https://www.example.com/contact-us.html?page=2"},
 		{"https://www.example.com", "/contact-us.html?page=2&id=3", "https://www.example.com/contact-us.html?page=2&id=3"},
+		{"https://www.example.com/about/", "team", "https://www.example.com/about/team"},
+		{"https://www.example.com/about/index.html", "team", "https://www.example.com/about/team"},
+		{"https://www.example.com/about", "team", "https://www.example.com/team"},
+		{"https://www.example.com/about/team/", "../careers", "https://www.example.com/about/careers"},
+		{"https://www.example.com/about/team/", "../../../careers", "https://www.example.com/careers"},
+		{"https://www.example.com/about/", "./team?x=1", "https://www.example.com/about/team?x=1"},
+		{"https://www.example.com/about/", "//cdn.example.com/x", "https://cdn.example.com/x"},
+		{"http://www.example.com/about/", "//cdn.example.com/x", "http://cdn.example.com/x"},
+		{"https://www.example.com/about/", "?page=2", "https://www.example.com/about/?page=2"},
+		{"https://www.example.com/about/", "  team\n", "https://www.example.com/about/team"},
 	}
 
 	for _, tc := range tt {
@@ -32,51 +46,154 @@ func TestNormaliseURL(t *testing.T) {
 	}
 }
 
-func TestGetLinkFromToken(t *testing.T) {
+func TestGetLinks(t *testing.T) {
 	tt := []struct {
-		token html.Token
-		out   string
-		found bool
+		node  *html.Node
+		links []Link
 	}{
 		{
-			html.Token{
+			&html.Node{
+				Type: html.ElementNode,
 				Data: "a",
 				Attr: []html.Attribute{
 					{Key: "href", Val: "https://example.com"},
 				},
 			},
-			"https://example.com",
-			true,
+			[]Link{{URL: "https://example.com", Kind: KindAnchor}},
 		},
 		{
-			html.Token{
+			&html.Node{
+				Type: html.ElementNode,
 				Data: "a",
 				Attr: []html.Attribute{
 					{Key: "no", Val: "https://example.com"},
 				},
 			},
-			"",
-			false,
+			[]Link{},
 		},
 		{
-			html.Token{
+			&html.Node{
+				Type: html.ElementNode,
 				Data: "div",
 				Attr: []html.Attribute{
 					{Key: "href", Val: "https://example.com"},
 				},
 			},
-			"",
-			false,
+			[]Link{},
+		},
+		{
+			&html.Node{Type: html.ElementNode, Data: "area", Attr: []html.Attribute{{Key: "href", Val: "/map"}}},
+			[]Link{{URL: "/map", Kind: KindArea}},
+		},
+		{
+			&html.Node{Type: html.ElementNode, Data: "iframe", Attr: []html.Attribute{{Key: "src", Val: "/embed"}}},
+			[]Link{{URL: "/embed", Kind: KindIframe}},
+		},
+		{
+			&html.Node{Type: html.ElementNode, Data: "form", Attr: []html.Attribute{{Key: "action", Val: "/search"}, {Key: "method", Val: "get"}}},
+			[]Link{{URL: "/search", Kind: KindForm}},
+		},
+		{
+			&html.Node{Type: html.ElementNode, Data: "script", Attr: []html.Attribute{{Key: "src", Val: "/app.js"}}},
+			[]Link{{URL: "/app.js", Kind: KindScript}},
+		},
+		{
+			&html.Node{Type: html.ElementNode, Data: "script"},
+			[]Link{},
+		},
+		{
+			&html.Node{Type: html.ElementNode, Data: "img", Attr: []html.Attribute{{Key: "src", Val: "a.png"}, {Key: "srcset", Val: "a-2x.png 2x, a-3x.png 3x"}}},
+			[]Link{{URL: "a.png", Kind: KindImage}, {URL: "a-2x.png", Kind: KindImage}, {URL: "a-3x.png", Kind: KindImage}},
+		},
+		{
+			&html.Node{Type: html.ElementNode, Data: "source", Attr: []html.Attribute{{Key: "srcset", Val: "b.webp"}}},
+			[]Link{{URL: "b.webp", Kind: KindImage}},
+		},
+		{
+			&html.Node{Type: html.ElementNode, Data: "meta", Attr: []html.Attribute{{Key: "http-equiv", Val: "Refresh"}, {Key: "content", Val: "0; URL='/moved'"}}},
+			[]Link{{URL: "/moved", Kind: KindMetaRefresh}},
+		},
+		{
+			&html.Node{Type: html.ElementNode, Data: "meta", Attr: []html.Attribute{{Key: "http-equiv", Val: "refresh"}, {Key: "content", Val: "30"}}},
+			[]Link{},
+		},
+		{
+			&html.Node{Type: html.ElementNode, Data: "link", Attr: []html.Attribute{{Key: "rel", Val: "stylesheet"}, {Key: "href", Val: "/style.css"}}},
+			[]Link{{URL: "/style.css", Kind: KindStylesheet}},
+		},
+		{
+			&html.Node{Type: html.ElementNode, Data: "link", Attr: []html.Attribute{{Key: "rel", Val: "alternate stylesheet"}, {Key: "href", Val: "/dark.css"}}},
+			[]Link{{URL: "/dark.css", Kind: KindStylesheet}},
+		},
+		{
+			&html.Node{Type: html.ElementNode, Data: "link", Attr: []html.Attribute{{Key: "rel", Val: "Canonical"}, {Key: "href", Val: "/page"}}},
+			[]Link{{URL: "/page", Kind: KindCanonical}},
+		},
+		{
+			&html.Node{Type: html.ElementNode, Data: "link", Attr: []html.Attribute{{Key: "rel", Val: "alternate"}, {Key: "hreflang", Val: "fr"}, {Key: "href", Val: "/fr/"}}},
+			[]Link{{URL: "/fr/", Kind: KindAlternate}},
+		},
+		{
+			&html.Node{Type: html.ElementNode, Data: "link", Attr: []html.Attribute{{Key: "rel", Val: "next"}, {Key: "href", Val: "?page=3"}}},
+			[]Link{{URL: "?page=3", Kind: KindNext}},
+		},
+		{
+			&html.Node{Type: html.ElementNode, Data: "link", Attr: []html.Attribute{{Key: "rel", Val: "prev"}, {Key: "href", Val: "?page=1"}}},
+			[]Link{{URL: "?page=1", Kind: KindPrev}},
+		},
+		{
+			&html.Node{Type: html.ElementNode, Data: "link", Attr: []html.Attribute{{Key: "rel", Val: "icon"}, {Key: "href", Val: "/favicon.ico"}}},
+			[]Link{},
 		},
 	}
 
 	for _, tc := range tt {
-		l, ok := getLinkFromToken(tc.token)
-		if ok != tc.found {
-			t.Errorf("expecting link %s found %v, got %v", l, tc.found, ok)
+		links := getLinks(tc.node)
+		if !reflect.DeepEqual(links, tc.links) {
+			t.Errorf("expecting links %v from <%s>, got %v", tc.links, tc.node.Data, links)
 		}
-		if l != tc.out {
-			t.Errorf("expected link %s, got %s", tc.out, l)
+	}
+}
+
+func TestParseSrcset(t *testing.T) {
+	tt := []struct {
+		srcset string
+		urls   []string
+	}{
+		{"", []string{}},
+		{"a.png", []string{"a.png"}},
+		{"a.png 1x, b.png 2x", []string{"a.png", "b.png"}},
+		{"a.png 480w,b.png 800w", []string{"a.png", "b.png"}},
+		{"a.png, b.png 2x", []string{"a.png", "b.png"}},
+		{" /img/a,1.png 1x , /img/b.png 2x ", []string{"/img/a,1.png", "/img/b.png"}},
+	}
+
+	for _, tc := range tt {
+		urls := parseSrcset(tc.srcset)
+		if !reflect.DeepEqual(urls, tc.urls) {
+			t.Errorf("expecting %q to have urls %v, got %v", tc.srcset, tc.urls, urls)
+		}
+	}
+}
+
+func TestParseRefresh(t *testing.T) {
+	tt := []struct {
+		content string
+		url     string
+		found   bool
+	}{
+		{"5", "", false},
+		{"0; url=/next", "/next", true},
+		{"0;URL=https://example.com/", "https://example.com/", true},
+		{"3; url = \"/quoted\"", "/quoted", true},
+		{"0, /comma", "/comma", true},
+		{"0;", "", false},
+	}
+
+	for _, tc := range tt {
+		u, found := parseRefresh(tc.content)
+		if u != tc.url || found != tc.found {
+			t.Errorf("expecting %q to refresh to %q (%t), got %q (%t)", tc.content, tc.url, tc.found, u, found)
 		}
 	}
 }
@@ -122,3 +239,309 @@ func TestExtractLinks(t *testing.T) {
 		}
 	}
 }
+
+func TestParserExtractLinks(t *testing.T) {
+	p := NewParser(normalizer.New(normalizer.DefaultTrackingParams, false))
+	body := fmt.Sprintf(template, `<a href="/"></a><a href="https://EXAMPLE.com/#top"></a><a href="/blog?utm_source=x&page=2"></a><a href="/a/../careers"></a>`)
+
+	links := p.ExtractLinks(strings.NewReader(body), "https://example.com")
+	expected := []string{"https://example.com/", "https://example.com/", "https://example.com/blog?page=2", "https://example.com/careers"}
+	if !reflect.DeepEqual(links, expected) {
+		t.Errorf("expecting links %v, got %v", expected, links)
+	}
+}
+
+func TestExtractLinksBase(t *testing.T) {
+	tt := []struct {
+		name  string
+		body  string
+		page  string
+		links []string
+	}{
+		{
+			"relative to the page",
+			fmt.Sprintf(template, `<a href="team"></a><a href="../blog/"></a>`),
+			"https://example.com/about/us/",
+			[]string{"https://example.com/about/us/team", "https://example.com/about/blog/"},
+		},
+		{
+			"absolute base",
+			`<html><head><base href="https://static.example.com/docs/"></head><body><a href="guide"></a><a href="/root"></a></body></html>`,
+			"https://example.com/about/",
+			[]string{"https://static.example.com/docs/guide", "https://static.example.com/root"},
+		},
+		{
+			"relative base resolved against the page",
+			`<html><head><base href="../v2/"/></head><body><a href="guide"></a></body></html>`,
+			"https://example.com/docs/v1/index.html",
+			[]string{"https://example.com/docs/v2/guide"},
+		},
+		{
+			"protocol relative base",
+			`<html><head><base href="//cdn.example.com/"></head><body><a href="x"></a></body></html>`,
+			"http://example.com/",
+			[]string{"http://cdn.example.com/x"},
+		},
+		{
+			"only the first base counts, also for the links before it",
+			`<html><head></head><body><a href="a"></a><base href="/first/"><base href="/second/"><a href="b"></a></body></html>`,
+			"https://example.com/about/",
+			[]string{"https://example.com/first/a", "https://example.com/first/b"},
+		},
+		{
+			"base without href",
+			`<html><head><base target="_blank"><base href="/docs/"></head><body><a href="a"></a></body></html>`,
+			"https://example.com/about/",
+			[]string{"https://example.com/docs/a"},
+		},
+	}
+
+	for _, tc := range tt {
+		links := ExtractLinks(strings.NewReader(tc.body), tc.page)
+		if !reflect.DeepEqual(links, tc.links) {
+			t.Errorf("%s: expecting links %v, got %v", tc.name, tc.links, links)
+		}
+	}
+}
+
+func TestParserLinks(t *testing.T) {
+	body := `<html><head>
+	<link rel="stylesheet" href="/style.css">
+	<link rel="canonical" href="https://example.com/page">
+	<meta http-equiv="refresh" content="10; url=/next">
+	<script src="app.js"></script>
+	</head><body>
+	<a href="about"></a>
+	<img src="logo.png" srcset="logo-2x.png 2x">
+	<form action="/search"></form>
+	</body></html>`
+
+	links := NewParser(nil).Links(strings.NewReader(body), "https://example.com/docs/")
+	expected := []Link{
+		{URL: "https://example.com/style.css", Kind: KindStylesheet},
+		{URL: "https://example.com/page", Kind: KindCanonical},
+		{URL: "https://example.com/next", Kind: KindMetaRefresh},
+		{URL: "https://example.com/docs/app.js", Kind: KindScript},
+		{URL: "https://example.com/docs/about", Kind: KindAnchor},
+		{URL: "https://example.com/docs/logo.png", Kind: KindImage},
+		{URL: "https://example.com/docs/logo-2x.png", Kind: KindImage},
+		{URL: "https://example.com/search", Kind: KindForm},
+	}
+	if !reflect.DeepEqual(links, expected) {
+		t.Errorf("expecting links %v, got %v", expected, links)
+	}
+}
+
+func TestParseKind(t *testing.T) {
+	for _, k := range Kinds {
+		parsed, err := ParseKind(string(k))
+		if err != nil || parsed != k {
+			t.Errorf("expecting %q to be parsed, got %q (%v)", k, parsed, err)
+		}
+	}
+	if _, err := ParseKind("video"); err == nil {
+		t.Error("expecting an error parsing an unknown kind")
+	}
+}
+
+func TestParseNonNavigable(t *testing.T) {
+	body := fmt.Sprintf(template, `<a href="mailto:info@example.com"></a><a href="tel:+441234567890"></a>`+
+		`<a href="javascript:void(0)"></a><img src="data:image/png;base64,`+strings.Repeat("A", 200)+`">`+
+		`<a href="http://[::1"></a><a href="/about"></a><a href="ftp://example.com/file"></a>`)
+
+	doc := NewParser(nil).Parse(strings.NewReader(body), "https://example.com/")
+	if !reflect.DeepEqual(doc.Links, []Link{{URL: "https://example.com/about", Kind: KindAnchor}}) {
+		t.Errorf("expecting only the http link to be crawlable, got %v", doc.Links)
+	}
+	expected := []Link{
+		{URL: "mailto:info@example.com", Kind: KindAnchor},
+		{URL: "tel:+441234567890", Kind: KindAnchor},
+		{URL: "javascript:void(0)", Kind: KindAnchor},
+		{URL: "data:image/png;base64," + strings.Repeat("A", 100-len("data:image/png;base64,")) + "...", Kind: KindImage},
+		{URL: "ftp://example.com/file", Kind: KindAnchor},
+	}
+	if !reflect.DeepEqual(doc.NonNavigable, expected) {
+		t.Errorf("expecting non-navigable links %v, got %v", expected, doc.NonNavigable)
+	}
+	if len(doc.Warnings) != 1 || !strings.Contains(doc.Warnings[0], `"http://[::1"`) {
+		t.Errorf("expecting a warning with the malformed href, got %v", doc.Warnings)
+	}
+}
+
+func TestParseRobots(t *testing.T) {
+	tt := []struct {
+		body       string
+		directives robots.Directives
+		nofollow   []bool
+	}{
+		{
+			fmt.Sprintf(template, `<a href="/a"></a><a href="/b" rel="nofollow"></a><a href="/c" rel="external NoFollow"></a>`),
+			robots.Directives{},
+			[]bool{false, true, true},
+		},
+		{
+			`<html><head><meta name="Robots" content="noindex, nofollow"></head><body><a href="/a"></a></body></html>`,
+			robots.Directives{NoIndex: true, NoFollow: true},
+			[]bool{false},
+		},
+		{
+			`<html><head><meta name="robots" content="noindex"><meta name="robots" content="nofollow"><meta name="description" content="none"></head></html>`,
+			robots.Directives{NoIndex: true, NoFollow: true},
+			[]bool{},
+		},
+	}
+
+	for _, tc := range tt {
+		doc := NewParser(nil).Parse(strings.NewReader(tc.body), "https://example.com/")
+		if doc.Robots != tc.directives {
+			t.Errorf("expecting directives %+v, got %+v", tc.directives, doc.Robots)
+		}
+		nofollow := []bool{}
+		for _, l := range doc.Links {
+			nofollow = append(nofollow, l.Nofollow)
+		}
+		if !reflect.DeepEqual(nofollow, tc.nofollow) {
+			t.Errorf("expecting nofollow links %v, got %v", tc.nofollow, nofollow)
+		}
+	}
+}
+
+func TestParseAnchors(t *testing.T) {
+	body := `<html><body>
+<header><a href="/" title="Home page"><img src="/logo.png" alt="Example"></a></header>
+<div role="navigation"><a href="/about" rel="external nofollow">About
+	<b>us</b></a></div>
+<main><p><a href="/post">Read  the <i>post</i></a></p><map><area href="/map" alt="Map area"></map></main>
+<footer><nav><a href="/terms">Terms</a></nav><a href="/contact">Contact</a></footer>
+<a href="/orphan"></a>
+</body></html>`
+
+	expected := []Link{
+		{URL: "https://example.com/", Kind: KindAnchor, Text: "Example", Title: "Home page", Position: PositionHeader},
+		{URL: "https://example.com/logo.png", Kind: KindImage, Position: PositionHeader},
+		{URL: "https://example.com/about", Kind: KindAnchor, Nofollow: true, Text: "About us", Rel: "external nofollow", Position: PositionNav},
+		{URL: "https://example.com/post", Kind: KindAnchor, Text: "Read the post", Position: PositionMain},
+		{URL: "https://example.com/map", Kind: KindArea, Text: "Map area", Position: PositionMain},
+		{URL: "https://example.com/terms", Kind: KindAnchor, Text: "Terms", Position: PositionNav},
+		{URL: "https://example.com/contact", Kind: KindAnchor, Text: "Contact", Position: PositionFooter},
+		{URL: "https://example.com/orphan", Kind: KindAnchor},
+	}
+	links := NewParser(nil).Links(strings.NewReader(body), "https://example.com/")
+	if !reflect.DeepEqual(links, expected) {
+		t.Errorf("expecting %+v, got %+v", expected, links)
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	body := `<!DOCTYPE html>
+<html lang="en-GB">
+<head>
+	<title> Example
+		page </title>
+	<title>Ignored</title>
+	<meta name="Description" content=" An example page ">
+	<meta property="og:title" content="Example">
+	<meta property="og:image" content="https://example.com/og.png">
+	<meta name="twitter:card" content="summary">
+	<link rel="Canonical" href="/page">
+	<style>body { color: red; }</style>
+</head>
+<body>
+	<svg><title>Icon</title></svg>
+	<h1>Welcome <img src="/wave.png" alt="wave"></h1>
+	<p>Some text to be counted.</p>
+	<h2>Section</h2>
+	<h4>Not in the outline</h4>
+	<h3>Sub section</h3>
+	<script>var notCounted = "words";</script>
+</body>
+</html>`
+
+	expected := Metadata{
+		Title:       "Example page",
+		Description: "An example page",
+		Headings:    []Heading{{Level: 1, Text: "Welcome wave"}, {Level: 2, Text: "Section"}, {Level: 3, Text: "Sub section"}},
+		Canonical:   "https://example.com/page",
+		Lang:        "en-GB",
+		OpenGraph:   map[string]string{"og:title": "Example", "og:image": "https://example.com/og.png"},
+		Twitter:     map[string]string{"twitter:card": "summary"},
+		WordCount:   14,
+	}
+	doc := NewParser(nil).Parse(strings.NewReader(body), "https://example.com/dir/")
+	if !reflect.DeepEqual(doc.Metadata, expected) {
+		t.Errorf("expecting %+v, got %+v", expected, doc.Metadata)
+	}
+
+	doc = NewParser(nil).Parse(strings.NewReader(`<p>no metadata</p>`), "https://example.com/")
+	if !reflect.DeepEqual(doc.Metadata, Metadata{WordCount: 2}) {
+		t.Errorf("expecting empty metadata, got %+v", doc.Metadata)
+	}
+}
+
+func TestParseCharset(t *testing.T) {
+	tt := []struct {
+		file        string
+		contentType string
+		charset     string
+		title       string
+		link        Link
+	}{
+		{"shift_jis.html", "text/html", "shift_jis", "東京の天気", Link{URL: "https://example.com/%E6%9D%B1%E4%BA%AC", Kind: KindAnchor, Text: "東京"}},
+		{"iso-8859-1.html", "text/html; charset=ISO-8859-1", "windows-1252", "Le café", Link{URL: "https://example.com/caf%C3%A9", Kind: KindAnchor, Text: "Café crème"}},
+		{"windows-1251.html", "", "windows-1251", "Привет", Link{URL: "https://example.com/%D0%BD%D0%BE%D0%B2%D0%BE%D1%81%D1%82%D0%B8", Kind: KindAnchor, Text: "Новости"}},
+		// the Content-Type takes precedence over <meta charset>
+		{"windows-1251.html", "text/html; charset=koi8-r", "koi8-r", "Привет", Link{}},
+		// the BOM takes precedence over the Content-Type
+		{"utf-8-bom.html", "text/html; charset=iso-8859-1", "utf-8", "Grüße", Link{URL: "https://example.com/%C3%BCber", Kind: KindAnchor, Text: "Über uns"}},
+		{"utf-16le.html", "text/html", "utf-16le", "Καλημέρα", Link{URL: "https://example.com/%CE%BD%CE%AD%CE%B1", Kind: KindAnchor, Text: "Νέα"}},
+	}
+
+	for _, tc := range tt {
+		f, err := os.Open(filepath.Join("testdata", tc.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc := NewParser(nil).ParseResponse(f, "https://example.com/", tc.contentType)
+		f.Close()
+		if doc.Charset != tc.charset {
+			t.Errorf("expecting %s to be decoded from %s, got %s", tc.file, tc.charset, doc.Charset)
+		}
+		if tc.link.URL == "" {
+			// decoded with the wrong charset
+			if doc.Metadata.Title == tc.title {
+				t.Errorf("expecting %s not to be decoded correctly", tc.file)
+			}
+			continue
+		}
+		if doc.Metadata.Title != tc.title {
+			t.Errorf("expecting %s to have title %q, got %q", tc.file, tc.title, doc.Metadata.Title)
+		}
+		if len(doc.Links) != 1 || !reflect.DeepEqual(doc.Links[0], tc.link) {
+			t.Errorf("expecting %s to link %+v, got %+v", tc.file, tc.link, doc.Links)
+		}
+	}
+}
+
+func TestParseUndeclaredCharset(t *testing.T) {
+	// UTF-8 text beyond the bytes examined to detect the encoding
+	utf8 := "<html><body>" + strings.Repeat("<p>ascii</p>", 100) + "<a href=\"/\">Grüße</a></body></html>"
+	// windows-1252 text from the beginning
+	latin1 := "<html><head><title>Gr\xfc\xdfe</title></head><body><a href=\"/\">Gr\xfc\xdfe</a></body></html>"
+
+	tt := []struct {
+		body    string
+		charset string
+	}{
+		{utf8, "utf-8"},
+		{latin1, "windows-1252"},
+	}
+	for _, tc := range tt {
+		doc := NewParser(nil).Parse(strings.NewReader(tc.body), "https://example.com/")
+		if doc.Charset != tc.charset {
+			t.Errorf("expecting the page to be decoded from %s, got %s", tc.charset, doc.Charset)
+		}
+		if len(doc.Links) != 1 || doc.Links[0].Text != "Grüße" {
+			t.Errorf("expecting the anchor text to be decoded, got %+v", doc.Links)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Kind is the kind of a link, i.e. the element and attribute it was found in
+type Kind string
+
+const (
+	// KindAnchor is a <a href> link
+	KindAnchor Kind = "anchor"
+	// KindArea is a <area href> link of an image map
+	KindArea Kind = "area"
+	// KindIframe is the source of a <iframe> or <frame>
+	KindIframe Kind = "iframe"
+	// KindForm is the action of a <form>
+	KindForm Kind = "form"
+	// KindMetaRefresh is the URL of a <meta http-equiv="refresh">
+	KindMetaRefresh Kind = "refresh"
+	// KindStylesheet is a <link rel="stylesheet">
+	KindStylesheet Kind = "stylesheet"
+	// KindScript is the source of a <script>
+	KindScript Kind = "script"
+	// KindImage is the source of a <img>, including the candidates of srcset
+	KindImage Kind = "image"
+	// KindAlternate is a <link rel="alternate">, e.g. a translation or a feed
+	KindAlternate Kind = "alternate"
+	// KindCanonical is a <link rel="canonical">
+	KindCanonical Kind = "canonical"
+	// KindNext is a <link rel="next">
+	KindNext Kind = "next"
+	// KindPrev is a <link rel="prev">
+	KindPrev Kind = "prev"
+)
+
+// Kinds are all the kinds of links
+var Kinds = []Kind{KindAnchor, KindArea, KindIframe, KindForm, KindMetaRefresh, KindStylesheet, KindScript,
+	KindImage, KindAlternate, KindCanonical, KindNext, KindPrev}
+
+// ParseKind returns the kind of link with the given name
+func ParseKind(name string) (Kind, error) {
+	for _, k := range Kinds {
+		if string(k) == name {
+			return k, nil
+		}
+	}
+	return "", fmt.Errorf("unknown link kind %q", name)
+}
+
+// Link is a link found in a page
+type Link struct {
+	URL  string
+	Kind Kind
+	// Nofollow is true if the link has rel="nofollow"
+	Nofollow bool
+	// Text is the text of an anchor, including the alt text of its images
+	Text string
+	// Title is the title attribute of an anchor
+	Title string
+	// Rel is the rel attribute of an anchor
+	Rel string
+	// Position is the landmark of the page containing the link
+	Position Position
+}
+
+// Position is the landmark of the page a link is found in
+type Position string
+
+const (
+	// PositionHeader is a <header> or an element with role="banner"
+	PositionHeader Position = "header"
+	// PositionNav is a <nav> or an element with role="navigation"
+	PositionNav Position = "nav"
+	// PositionMain is a <main> or an element with role="main"
+	PositionMain Position = "main"
+	// PositionFooter is a <footer> or an element with role="contentinfo"
+	PositionFooter Position = "footer"
+)
+
+// getLandmark returns the position of the links contained in a HTML node, if it's a landmark
+func getLandmark(n *html.Node) (Position, bool) {
+	switch n.Data {
+	case "header":
+		return PositionHeader, true
+	case "nav":
+		return PositionNav, true
+	case "main":
+		return PositionMain, true
+	case "footer":
+		return PositionFooter, true
+	}
+	for _, attr := range n.Attr {
+		if attr.Key != "role" {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(attr.Val)) {
+		case "banner":
+			return PositionHeader, true
+		case "navigation":
+			return PositionNav, true
+		case "main":
+			return PositionMain, true
+		case "contentinfo":
+			return PositionFooter, true
+		}
+	}
+	return "", false
+}
+
+// anchorText returns the text of a link with collapsed whitespace, using the alt text of <area>
+func anchorText(n *html.Node) string {
+	if n.Data == "area" {
+		alt, _ := getAttr(n, "alt")
+		return strings.Join(strings.Fields(alt), " ")
+	}
+	return textContent(n)
+}
+
+// getAttr returns the value of an attribute of a HTML node
+func getAttr(n *html.Node, key string) (string, bool) {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+// getLinks extracts the links from a HTML node, along with their kind
+func getLinks(n *html.Node) []Link {
+	links := []Link{}
+	rel, _ := getAttr(n, "rel")
+	rel = strings.ToLower(rel)
+	nofollow := hasToken(rel, "nofollow")
+	add := func(attr string, kind Kind) {
+		if v, ok := getAttr(n, attr); ok {
+			links = append(links, Link{URL: v, Kind: kind, Nofollow: nofollow})
+		}
+	}
+
+	switch n.Data {
+	case "a":
+		add("href", KindAnchor)
+	case "area":
+		add("href", KindArea)
+	case "iframe", "frame":
+		add("src", KindIframe)
+	case "form":
+		add("action", KindForm)
+	case "script":
+		add("src", KindScript)
+	case "img":
+		add("src", KindImage)
+		fallthrough
+	case "source":
+		if srcset, ok := getAttr(n, "srcset"); ok {
+			for _, u := range parseSrcset(srcset) {
+				links = append(links, Link{URL: u, Kind: KindImage})
+			}
+		}
+	case "meta":
+		if httpEquiv, _ := getAttr(n, "http-equiv"); strings.EqualFold(httpEquiv, "refresh") {
+			content, _ := getAttr(n, "content")
+			if u, ok := parseRefresh(content); ok {
+				links = append(links, Link{URL: u, Kind: KindMetaRefresh})
+			}
+		}
+	case "link":
+		for _, r := range strings.Fields(rel) {
+			switch r {
+			case "stylesheet":
+				add("href", KindStylesheet)
+			case "canonical":
+				add("href", KindCanonical)
+			case "alternate":
+				// alternate stylesheets are stylesheets
+				if !hasToken(rel, "stylesheet") {
+					add("href", KindAlternate)
+				}
+			case "next":
+				add("href", KindNext)
+			case "prev", "previous":
+				add("href", KindPrev)
+			}
+		}
+	}
+	return links
+}
+
+// hasToken returns true if a space separated list of tokens, e.g. the value of rel, contains the token
+func hasToken(list, token string) bool {
+	for _, t := range strings.Fields(list) {
+		if t == token {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSrcset returns the URLs of the image candidates of a srcset attribute, e.g. "a.png 1x, b.png 2x"
+func parseSrcset(srcset string) []string {
+	urls := []string{}
+	for {
+		srcset = strings.TrimLeft(srcset, " \t\n\r\f,")
+		if srcset == "" {
+			return urls
+		}
+		end := strings.IndexAny(srcset, " \t\n\r\f")
+		if end < 0 {
+			end = len(srcset)
+		}
+		u := srcset[:end]
+		srcset = srcset[end:]
+		if strings.HasSuffix(u, ",") {
+			// a candidate without descriptors
+			urls = append(urls, strings.TrimRight(u, ","))
+			continue
+		}
+		urls = append(urls, u)
+
+		// skip the descriptors, up to the comma separating the next candidate
+		inParens := false
+		i := 0
+		for ; i < len(srcset); i++ {
+			if srcset[i] == '(' {
+				inParens = true
+			} else if srcset[i] == ')' {
+				inParens = false
+			} else if srcset[i] == ',' && !inParens {
+				break
+			}
+		}
+		srcset = srcset[i:]
+	}
+}
+
+// parseRefresh returns the URL of the content of a meta refresh, e.g. "5; url=/next"
+func parseRefresh(content string) (string, bool) {
+	i := strings.IndexAny(content, ";,")
+	if i < 0 {
+		return "", false
+	}
+	u := strings.TrimSpace(content[i+1:])
+	if len(u) >= 3 && strings.EqualFold(u[:3], "url") {
+		rest := strings.TrimSpace(u[3:])
+		if strings.HasPrefix(rest, "=") {
+			u = strings.TrimSpace(rest[1:])
+		}
+	}
+	if len(u) > 0 && (u[0] == '\'' || u[0] == '"') {
+		quote := u[0]
+		u = u[1:]
+		if end := strings.IndexByte(u, quote); end >= 0 {
+			u = u[:end]
+		}
+	}
+	return u, u != ""
+}
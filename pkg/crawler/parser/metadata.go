@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Metadata holds the information describing a page, found in its HTML
+type Metadata struct {
+	// Title is the text of the <title> of the page
+	Title string
+	// Description is the content of <meta name="description">
+	Description string
+	// Headings is the outline of the page, made of its H1, H2 and H3 headings in document order
+	Headings []Heading
+	// Canonical is the absolute URL of the <link rel="canonical"> of the page
+	Canonical string
+	// Lang is the lang attribute of the <html> element
+	Lang string
+	// OpenGraph are the Open Graph properties of the page, e.g. og:title, by property
+	OpenGraph map[string]string
+	// Twitter are the Twitter card properties of the page, e.g. twitter:card, by name
+	Twitter map[string]string
+	// WordCount is the number of words of the visible text of the page
+	WordCount int
+}
+
+// Heading is a H1, H2 or H3 heading of a page
+type Heading struct {
+	Level int
+	Text  string
+}
+
+// headingLevels are the levels of the headings included in the outline of a page
+var headingLevels = map[string]int{"h1": 1, "h2": 2, "h3": 3}
+
+// invisibleElements are the elements whose text isn't displayed, and isn't counted as words of the page
+var invisibleElements = map[string]bool{"head": true, "script": true, "style": true, "noscript": true, "template": true}
+
+// collect records the metadata found in a HTML element. Only the first title, description,
+// canonical link and occurrence of each property is kept, as search engines do.
+// It walks the tree built by html.Parse for the links rather than a html.Tokenizer: the text of
+// titles and headings spans several tokens, and the tree already nests it under its element.
+func (m *Metadata) collect(n *html.Node, inSVG bool) {
+	switch n.Data {
+	case "html":
+		if lang, ok := getAttr(n, "lang"); ok && m.Lang == "" {
+			m.Lang = strings.TrimSpace(lang)
+		}
+	case "title":
+		// <title> is also used by SVG images for their tooltips
+		if !inSVG && m.Title == "" {
+			m.Title = textContent(n)
+		}
+	case "h1", "h2", "h3":
+		m.Headings = append(m.Headings, Heading{Level: headingLevels[n.Data], Text: textContent(n)})
+	case "link":
+		if rel, _ := getAttr(n, "rel"); hasToken(strings.ToLower(rel), "canonical") && m.Canonical == "" {
+			m.Canonical, _ = getAttr(n, "href")
+		}
+	case "meta":
+		content, _ := getAttr(n, "content")
+		content = strings.TrimSpace(content)
+		name, _ := getAttr(n, "name")
+		property, _ := getAttr(n, "property")
+		name, property = strings.ToLower(name), strings.ToLower(property)
+		switch {
+		case name == "description" && m.Description == "":
+			m.Description = content
+		case strings.HasPrefix(property, "og:"):
+			m.OpenGraph = setOnce(m.OpenGraph, property, content)
+		case strings.HasPrefix(name, "twitter:"):
+			m.Twitter = setOnce(m.Twitter, name, content)
+		case strings.HasPrefix(property, "twitter:"):
+			m.Twitter = setOnce(m.Twitter, property, content)
+		}
+	}
+}
+
+// setOnce sets a property unless already set, allocating the map if needed
+func setOnce(properties map[string]string, key, value string) map[string]string {
+	if properties == nil {
+		properties = make(map[string]string)
+	}
+	if _, ok := properties[key]; !ok {
+		properties[key] = value
+	}
+	return properties
+}
+
+// textContent returns the text of a HTML node with collapsed whitespace. Images are replaced by
+// their alt text, as it's the text of image links.
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var collect func(n *html.Node)
+	collect = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			b.WriteString(n.Data)
+		case n.Type == html.ElementNode && n.Data == "img":
+			alt, _ := getAttr(n, "alt")
+			b.WriteString(" " + alt + " ")
+		case n.Type == html.ElementNode && invisibleElements[n.Data]:
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// wordCount returns the number of words of the visible text of a HTML node
+func wordCount(n *html.Node) int {
+	switch {
+	case n.Type == html.TextNode:
+		return len(strings.Fields(n.Data))
+	case n.Type == html.ElementNode && invisibleElements[n.Data]:
+		return 0
+	}
+	count := 0
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		count += wordCount(c)
+	}
+	return count
+}
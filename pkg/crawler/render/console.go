@@ -3,23 +3,70 @@ package render
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 
+	"github.com/amartorelli/millipedes/pkg/crawler/report"
+	"github.com/amartorelli/millipedes/pkg/crawler/sitemap"
 	"github.com/sirupsen/logrus"
 )
 
 // ConsoleRender renders the sitemap printing it out on the console
 type ConsoleRender struct {
 	sitemap map[string][]string
+	links   map[string][]sitemap.Link
+	pages   map[string]sitemap.Page
+	broken  []report.BrokenLink
+}
+
+// consoleOutput is the JSON document printed on the console
+type consoleOutput struct {
+	Sitemap map[string][]string     `json:"sitemap"`
+	Pages   map[string]sitemap.Page `json:"pages,omitempty"`
+	// Links are the edges of the sitemap with their kind, anchor text, title, rel and position
+	Links map[string][]sitemap.Link `json:"links,omitempty"`
+	// NonNavigable lists the contact and JavaScript links of each page, which aren't part of the sitemap
+	NonNavigable map[string][]string `json:"non_navigable,omitempty"`
+	// NoIndex lists the pages asking not to be indexed
+	NoIndex []string `json:"noindex,omitempty"`
+	// Broken lists the URLs which couldn't be fetched, with the pages linking to them
+	Broken []report.BrokenLink `json:"broken,omitempty"`
+}
+
+// noIndex returns the sorted list of the pages asking not to be indexed
+func noIndex(pages map[string]sitemap.Page) []string {
+	urls := []string{}
+	for url, p := range pages {
+		if p.NoIndex {
+			urls = append(urls, url)
+		}
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// nonNavigable returns the links of each page that can't be crawled
+func nonNavigable(pages map[string]sitemap.Page) map[string][]string {
+	links := make(map[string][]string, 0)
+	for url, p := range pages {
+		for _, l := range p.NonNavigable {
+			links[url] = append(links[url], l.URL)
+		}
+	}
+	return links
 }
 
 // NewConsoleRender returns a new ConsoleRender
 func NewConsoleRender() *ConsoleRender {
-	return &ConsoleRender{sitemap: make(map[string][]string, 0)}
+	return &ConsoleRender{
+		sitemap: make(map[string][]string, 0),
+		links:   make(map[string][]sitemap.Link, 0),
+		pages:   make(map[string]sitemap.Page, 0),
+	}
 }
 
 // Render renders the sitemap
 func (r *ConsoleRender) Render() {
-	b, err := json.MarshalIndent(r.sitemap, "", "  ")
+	b, err := json.MarshalIndent(consoleOutput{Sitemap: r.sitemap, Pages: r.pages, Links: r.links, NonNavigable: nonNavigable(r.pages), NoIndex: noIndex(r.pages), Broken: r.broken}, "", "  ")
 	if err != nil {
 		logrus.Error(err)
 		return
@@ -28,7 +75,16 @@ func (r *ConsoleRender) Render() {
 }
 
 // UpdateSitemap updates the sitemap
-func (r *ConsoleRender) UpdateSitemap(sitemap map[string][]string) error {
-	r.sitemap = sitemap
+func (r *ConsoleRender) UpdateSitemap(sm sitemap.Sitemap) error {
+	// a single snapshot, so that the links and the pages are consistent while the crawl goes on
+	return r.UpdateGraph(sitemap.NewGraph(sm))
+}
+
+// UpdateGraph updates the sitemap from a snapshot already taken
+func (r *ConsoleRender) UpdateGraph(g *sitemap.Graph) error {
+	r.sitemap = g.Children()
+	r.links = g.Links()
+	r.pages = g.Pages()
+	r.broken = report.BrokenLinks(g)
 	return nil
 }
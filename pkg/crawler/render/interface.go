@@ -1,7 +1,10 @@
 package render
 
+import "github.com/amartorelli/millipedes/pkg/crawler/sitemap"
+
 // Render is the render interface
 type Render interface {
-	UpdateSitemap(sitemap map[string][]string) error
+	UpdateSitemap(sitemap sitemap.Sitemap) error
+	UpdateGraph(g *sitemap.Graph) error
 	Render()
 }
@@ -7,8 +7,11 @@ import (
 	"net/http"
 	"os/exec"
 	"runtime"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/amartorelli/millipedes/pkg/crawler/sitemap"
 	"github.com/sirupsen/logrus"
 )
 
@@ -17,7 +20,6 @@ type SigmajsRender struct {
 	server  *http.Server
 	mux     *http.ServeMux
 	content []byte
-	sitemap map[string][]string
 }
 
 // NewSigmajsRender returns a new ConsoleRender
@@ -31,8 +33,7 @@ func NewSigmajsRender(lAddr string) *SigmajsRender {
 			WriteTimeout:   10 * time.Second,
 			MaxHeaderBytes: 1 << 20,
 		},
-		mux:     mux,
-		sitemap: make(map[string][]string, 0),
+		mux: mux,
 	}
 }
 
@@ -43,13 +44,40 @@ type sigmaNode struct {
 	X     int    `json:"x"`
 	Y     int    `json:"y"`
 	Size  int    `json:"size"`
+	Color string `json:"color,omitempty"`
+	// Tooltip describes the page when hovering the node
+	Tooltip string `json:"tooltip,omitempty"`
 }
 
+const (
+	// pageColor is the color of the nodes of the pages crawled without issues, and of the links only
+	// known as targets. It's set explicitly, as the default color of the graph may mean something else.
+	pageColor = "#339966"
+	// skippedColor is the color of the nodes that haven't been crawled
+	skippedColor = "#999999"
+	// resourceColor is the color of the nodes which aren't HTML pages, e.g. images
+	resourceColor = "#6699cc"
+	// redirectColor is the color of the edges representing a redirect
+	redirectColor = "#f0a020"
+	// noindexColor is the color of the pages asking not to be indexed
+	noindexColor = "#9966cc"
+	// brokenColor is the color of the pages which couldn't be fetched
+	brokenColor = "#cc3333"
+	// nofollowColor is the color of the edges marked as nofollow
+	nofollowColor = "#cccccc"
+	// maxEdgeTextLen is the length anchor texts are truncated to in edge labels
+	maxEdgeTextLen = 40
+	// depthSpacing is the vertical space between two levels of depth
+	depthSpacing = 20
+)
+
 // sigmaEdge represents a sigma edge
 type sigmaEdge struct {
 	ID     string `json:"id"`
 	Source string `json:"source"`
 	Target string `json:"target"`
+	Label  string `json:"label,omitempty"`
+	Color  string `json:"color,omitempty"`
 }
 
 // sigma is the main sigma object
@@ -58,18 +86,28 @@ type sigma struct {
 	Edges []sigmaEdge `json:"edges"`
 }
 
-// sitemapToSigma converts a map[string][]string to a sigma structure
-// to allow it to be parsed and visualised by Sigma
-func sitemapToSigma(sitemap map[string][]string) sigma {
+// sitemapToSigma converts the links of a sitemap to a sigma structure
+// to allow it to be parsed and visualised by Sigma. Pages that haven't
+// been crawled are greyed out and labelled with the reason, the ones
+// which couldn't be fetched are red and labelled with the status code
+// or the kind of error, pages are labelled with their title and
+// described by a tooltip, resources other than HTML pages are labelled
+// with their type, as are noindex pages, and edges are labelled with
+// the kind of link, or the status code of redirects, their anchor text,
+// their position in the page and whether they're nofollow. The sitemap
+// is streamed, the pages are converted to nodes as they're read rather
+// than kept.
+func sitemapToSigma(r sitemap.Ranger) sigma {
 	s := sigma{
 		Nodes: make([]sigmaNode, 0),
 		Edges: make([]sigmaEdge, 0),
 	}
 	allNodes := make(map[string]int, 0)
 	seenEdges := make(map[string]struct{}, 0)
-	for n, ee := range sitemap {
+	r.RangeLinks(func(n string, ll []sitemap.Link) bool {
 		allNodes[n]++
-		for _, e := range ee {
+		for _, l := range ll {
+			e := l.URL
 			allNodes[e]++
 			ID := fmt.Sprintf("%s-%s", n, e)
 
@@ -80,17 +118,151 @@ func sitemapToSigma(sitemap map[string][]string) sigma {
 			}
 			seenEdges[ID] = struct{}{}
 			se := sigmaEdge{ID: ID, Source: n, Target: e}
+			labels := []string{}
+			if l.Redirect != 0 {
+				labels = append(labels, fmt.Sprintf("%d", l.Redirect))
+				se.Color = redirectColor
+			} else if l.Kind != "" && l.Kind != "anchor" {
+				labels = append(labels, l.Kind)
+			}
+			if l.Text != "" {
+				labels = append(labels, fmt.Sprintf("%q", truncate(l.Text, maxEdgeTextLen)))
+			}
+			if l.Position != "" {
+				labels = append(labels, l.Position)
+			}
+			if l.Nofollow {
+				labels = append(labels, "nofollow")
+				se.Color = nofollowColor
+			}
+			se.Label = strings.Join(labels, " ")
 			s.Edges = append(s.Edges, se)
 		}
-	}
+		return true
+	})
+
+	pageNodes := make(map[string]sigmaNode, 0)
+	r.RangePages(func(p sitemap.Page) bool {
+		// pages might not be linked by any other page, e.g. a blocked entrypoint
+		if _, ok := allNodes[p.URL]; !ok {
+			allNodes[p.URL] = 1
+		}
+		pageNodes[p.URL] = pageNode(p, allNodes[p.URL])
+		return true
+	})
 
 	for n := range allNodes {
-		s.Nodes = append(s.Nodes, sigmaNode{ID: n, Label: n, X: rand.Intn(100), Y: rand.Intn(100), Size: allNodes[n]})
+		node, ok := pageNodes[n]
+		if !ok {
+			node = sigmaNode{ID: n, Label: n, X: rand.Intn(100), Y: rand.Intn(100), Size: allNodes[n], Color: pageColor}
+		}
+		s.Nodes = append(s.Nodes, node)
 	}
 
 	return s
 }
 
+// pageNode returns the node of a page of the sitemap, labelled with its title and flags
+func pageNode(p sitemap.Page, size int) sigmaNode {
+	node := sigmaNode{ID: p.URL, Label: p.URL, X: rand.Intn(100), Size: size, Color: pageColor, Tooltip: tooltip(p.URL, p)}
+	if p.Metadata != nil && p.Metadata.Title != "" {
+		node.Label = p.Metadata.Title
+	}
+	// lay out the graph in layers by depth
+	node.Y = p.Depth*depthSpacing + rand.Intn(depthSpacing/2)
+
+	flags := []string{}
+	if p.NoIndex {
+		flags = append(flags, "noindex")
+		node.Color = noindexColor
+	}
+	if p.Resource != "" && p.Resource != sitemap.ResourceHTML {
+		flags = append(flags, p.Resource)
+		node.Color = resourceColor
+	}
+	if p.Skipped != "" {
+		flags = append(flags, p.Skipped)
+		node.Color = skippedColor
+	}
+	if p.Broken() {
+		flags = append(flags, brokenFlag(p))
+		node.Color = brokenColor
+	}
+	if len(flags) > 0 {
+		node.Label = fmt.Sprintf("%s (%s)", node.Label, strings.Join(flags, ", "))
+	}
+	return node
+}
+
+// tooltip returns the description of a page shown when hovering its node: its URL, response and metadata
+func tooltip(url string, p sitemap.Page) string {
+	lines := []string{url}
+	if r := p.Response; r != nil {
+		lines = append(lines, fmt.Sprintf("%d %s, %d bytes", r.Status, r.ContentType, r.Size))
+	}
+	if m := p.Metadata; m != nil {
+		if m.Title != "" {
+			lines = append(lines, "Title: "+m.Title)
+		}
+		if m.Description != "" {
+			lines = append(lines, "Description: "+m.Description)
+		}
+		for _, h := range m.Headings {
+			lines = append(lines, fmt.Sprintf("%sH%d: %s", strings.Repeat("  ", h.Level-1), h.Level, h.Text))
+		}
+		if m.Canonical != "" && m.Canonical != url {
+			lines = append(lines, "Canonical: "+m.Canonical)
+		}
+		if m.Lang != "" {
+			lines = append(lines, "Lang: "+m.Lang)
+		}
+		if m.Charset != "" {
+			lines = append(lines, "Charset: "+m.Charset)
+		}
+		for _, properties := range []map[string]string{m.OpenGraph, m.Twitter} {
+			keys := make([]string, 0, len(properties))
+			for k := range properties {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				lines = append(lines, fmt.Sprintf("%s: %s", k, properties[k]))
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%d words", m.WordCount))
+	}
+	if p.Skipped != "" {
+		lines = append(lines, "Skipped: "+p.Skipped)
+	}
+	if p.Error != "" {
+		lines = append(lines, "Error: "+p.Error)
+		if p.Attempts > 1 {
+			lines = append(lines, fmt.Sprintf("%d attempts", p.Attempts))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// brokenFlag returns the outcome of a page which couldn't be fetched: its status code, or the kind of error
+func brokenFlag(p sitemap.Page) string {
+	if p.Status != 0 {
+		return fmt.Sprintf("%d", p.Status)
+	}
+	if p.ErrorKind != "" {
+		return p.ErrorKind
+	}
+	return "error"
+}
+
+// truncate shortens a text to at most n runes
+func truncate(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n]) + "…"
+}
+
 // openBrowser opens a browser pointing to a URL. This function ensures compatibility with multiple OS
 func openBrowser(url string) error {
 	var cmd string
@@ -148,10 +320,27 @@ func (r *SigmajsRender) Render() error {
 	return nil
 }
 
-// UpdateSitemap updates the sitemap
-func (r *SigmajsRender) UpdateSitemap(sitemap map[string][]string) error {
-	r.sitemap = sitemap
-	sigma := sitemapToSigma(r.sitemap)
+// UpdateSitemap updates the sitemap, streaming a snapshot of it rather than loading it as a graph
+func (r *SigmajsRender) UpdateSitemap(sm sitemap.Sitemap) error {
+	var rg sitemap.Ranger = sm
+	snapshot, err := sm.Snapshot()
+	if err != nil {
+		logrus.Errorf("%s, the links and the pages may not be consistent", err)
+	} else {
+		defer snapshot.Close()
+		rg = snapshot
+	}
+	return r.update(rg)
+}
+
+// UpdateGraph updates the sitemap from a snapshot already taken
+func (r *SigmajsRender) UpdateGraph(g *sitemap.Graph) error {
+	return r.update(g)
+}
+
+// update converts the sitemap to the JSON content served to SigmaJS
+func (r *SigmajsRender) update(rg sitemap.Ranger) error {
+	sigma := sitemapToSigma(rg)
 	content, err := json.Marshal(sigma)
 	if err != nil {
 		return err
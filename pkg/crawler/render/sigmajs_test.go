@@ -4,15 +4,40 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/amartorelli/millipedes/pkg/crawler/sitemap"
 )
 
+// mapSitemap streams a sitemap written as maps
+type mapSitemap struct {
+	links map[string][]sitemap.Link
+	pages map[string]sitemap.Page
+}
+
+func (m mapSitemap) RangeLinks(fn func(url string, links []sitemap.Link) bool) {
+	for url, links := range m.links {
+		if !fn(url, links) {
+			return
+		}
+	}
+}
+
+func (m mapSitemap) RangePages(fn func(p sitemap.Page) bool) {
+	for url, p := range m.pages {
+		p.URL = url
+		if !fn(p) {
+			return
+		}
+	}
+}
+
 func TestDataHandler(t *testing.T) {
 	s := NewSigmajsRender(":9876")
-	sitemap := map[string][]string{
-		"https://example.com": []string{"https://example.com", "https://example.com/a"},
-	}
-	s.UpdateSitemap(sitemap)
+	sm := sitemap.NewMemorySitemap()
+	sm.AddChildren("https://example.com", []string{"https://example.com", "https://example.com/a"})
+	s.UpdateSitemap(sm)
 
 	rr := httptest.NewRecorder()
 	// when hitting the /data endpoint it should return json content
@@ -44,3 +69,164 @@ func TestDataHandler(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestSitemapToSigmaSkipped(t *testing.T) {
+	sm := map[string][]sitemap.Link{
+		"https://example.com": {{URL: "https://example.com/a"}, {URL: "https://example.com/private"}},
+	}
+	pages := map[string]sitemap.Page{
+		"https://example.com/private": {URL: "https://example.com/private", Skipped: sitemap.ReasonRobots},
+	}
+
+	s := sitemapToSigma(mapSitemap{sm, pages})
+	if len(s.Nodes) != 3 {
+		t.Fatalf("expecting 3 nodes, got %d", len(s.Nodes))
+	}
+	for _, n := range s.Nodes {
+		skipped := n.ID == "https://example.com/private"
+		if skipped != (n.Color == skippedColor) {
+			t.Errorf("expecting node %s to be greyed out only if skipped, got color %q", n.ID, n.Color)
+		}
+	}
+}
+
+func TestSitemapToSigmaBroken(t *testing.T) {
+	sm := map[string][]sitemap.Link{
+		"https://example.com": {{URL: "https://example.com/missing"}, {URL: "https://example.com/slow"}, {URL: "https://example.com/down"}},
+	}
+	pages := map[string]sitemap.Page{
+		"https://example.com":         {URL: "https://example.com", Status: 200},
+		"https://example.com/missing": {URL: "https://example.com/missing", Status: 404, Error: "https://example.com/missing response code 404", ErrorKind: "http status", Attempts: 1},
+		"https://example.com/slow":    {URL: "https://example.com/slow", Error: "error fetching https://example.com/slow: timeout", ErrorKind: "timeout", Attempts: 3},
+		"https://example.com/down":    {URL: "https://example.com/down", Error: "connection refused", Attempts: 1},
+	}
+	labels := map[string]string{
+		"https://example.com":         "https://example.com",
+		"https://example.com/missing": "https://example.com/missing (404)",
+		"https://example.com/slow":    "https://example.com/slow (timeout)",
+		"https://example.com/down":    "https://example.com/down (error)",
+	}
+
+	s := sitemapToSigma(mapSitemap{sm, pages})
+	for _, n := range s.Nodes {
+		broken := n.ID != "https://example.com"
+		if broken != (n.Color == brokenColor) || n.Label != labels[n.ID] {
+			t.Errorf("expecting only the broken nodes to be red and labelled with their outcome, got %+v", n)
+		}
+		if n.ID == "https://example.com/slow" && !strings.HasSuffix(n.Tooltip, "\nError: error fetching https://example.com/slow: timeout\n3 attempts") {
+			t.Errorf("expecting the tooltip to describe the error, got %q", n.Tooltip)
+		}
+	}
+}
+
+func TestSitemapToSigmaResources(t *testing.T) {
+	sm := map[string][]sitemap.Link{
+		"https://example.com":          {{URL: "https://example.com/logo.png"}},
+		"https://example.com/logo.png": nil,
+	}
+	pages := map[string]sitemap.Page{
+		"https://example.com":          {URL: "https://example.com", Resource: sitemap.ResourceHTML},
+		"https://example.com/logo.png": {URL: "https://example.com/logo.png", Depth: 1, Resource: sitemap.ResourceImage},
+	}
+
+	s := sitemapToSigma(mapSitemap{sm, pages})
+	for _, n := range s.Nodes {
+		switch n.ID {
+		case "https://example.com":
+			if n.Color != pageColor || n.Label != n.ID {
+				t.Errorf("expecting the HTML page to keep the default style, got %+v", n)
+			}
+		case "https://example.com/logo.png":
+			if n.Color != resourceColor || n.Label != "https://example.com/logo.png (image)" {
+				t.Errorf("expecting the image to be labelled with its type, got %+v", n)
+			}
+		}
+	}
+}
+
+func TestSitemapToSigmaEdges(t *testing.T) {
+	sm := map[string][]sitemap.Link{
+		"https://example.com": {
+			{URL: "https://example.com/old", Kind: "anchor"},
+			{URL: "https://example.com/style.css", Kind: "stylesheet"},
+			{URL: "https://example.com/about", Kind: "anchor", Text: "About us", Position: "nav"},
+			{URL: "https://example.com/post", Kind: "anchor", Text: "A very long anchor text which doesn't fit in the graph"},
+		},
+		"https://example.com/old": {{URL: "https://example.com/new", Redirect: 301}},
+	}
+
+	labels := map[string]string{
+		"https://example.com/old":       "",
+		"https://example.com/style.css": "stylesheet",
+		"https://example.com/new":       "301",
+		"https://example.com/about":     `"About us" nav`,
+		"https://example.com/post":      `"A very long anchor text which doesn't fi…"`,
+	}
+	s := sitemapToSigma(mapSitemap{sm, nil})
+	for _, e := range s.Edges {
+		if e.Label != labels[e.Target] {
+			t.Errorf("expecting the edge to %s to be labelled %q, got %q", e.Target, labels[e.Target], e.Label)
+		}
+		redirect := e.Source == "https://example.com/old"
+		if redirect != (e.Color == redirectColor) {
+			t.Errorf("expecting only the redirect to be colored, got %+v", e)
+		}
+	}
+}
+
+func TestSitemapToSigmaRobots(t *testing.T) {
+	sm := map[string][]sitemap.Link{
+		"https://example.com": {{URL: "https://example.com/private", Kind: "anchor", Nofollow: true}},
+	}
+	pages := map[string]sitemap.Page{
+		"https://example.com":         {URL: "https://example.com", NoIndex: true},
+		"https://example.com/private": {URL: "https://example.com/private", Depth: 1},
+	}
+
+	s := sitemapToSigma(mapSitemap{sm, pages})
+	for _, n := range s.Nodes {
+		noindex := n.ID == "https://example.com"
+		if noindex != (n.Label == n.ID+" (noindex)" && n.Color == noindexColor) {
+			t.Errorf("expecting only the noindex page to be flagged, got %+v", n)
+		}
+	}
+	if len(s.Edges) != 1 || s.Edges[0].Label != "nofollow" || s.Edges[0].Color != nofollowColor {
+		t.Errorf("expecting the nofollow edge to be flagged, got %+v", s.Edges)
+	}
+}
+
+func TestSitemapToSigmaMetadata(t *testing.T) {
+	sm := map[string][]sitemap.Link{
+		"https://example.com": {{URL: "https://example.com/private", Kind: "anchor"}},
+	}
+	pages := map[string]sitemap.Page{
+		"https://example.com": {
+			URL:      "https://example.com",
+			Response: &sitemap.Response{Status: 200, ContentType: "text/html", Size: 1024},
+			Metadata: &sitemap.Metadata{
+				Title:     "Example",
+				Headings:  []sitemap.Heading{{Level: 1, Text: "Welcome"}, {Level: 2, Text: "Section"}},
+				OpenGraph: map[string]string{"og:title": "Example"},
+				WordCount: 42,
+			},
+		},
+		"https://example.com/private": {URL: "https://example.com/private", Skipped: sitemap.ReasonRobots},
+	}
+
+	expected := map[string]sigmaNode{
+		"https://example.com": {
+			Label:   "Example",
+			Tooltip: "https://example.com\n200 text/html, 1024 bytes\nTitle: Example\nH1: Welcome\n  H2: Section\nog:title: Example\n42 words",
+		},
+		"https://example.com/private": {
+			Label:   "https://example.com/private (blocked by robots)",
+			Tooltip: "https://example.com/private\nSkipped: blocked by robots",
+		},
+	}
+	s := sitemapToSigma(mapSitemap{sm, pages})
+	for _, n := range s.Nodes {
+		if n.Label != expected[n.ID].Label || n.Tooltip != expected[n.ID].Tooltip {
+			t.Errorf("expecting node %s labelled %q with tooltip %q, got %q and %q", n.ID, expected[n.ID].Label, expected[n.ID].Tooltip, n.Label, n.Tooltip)
+		}
+	}
+}
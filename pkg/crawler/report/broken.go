@@ -0,0 +1,77 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/amartorelli/millipedes/pkg/crawler/sitemap"
+)
+
+// BrokenLink is a URL which couldn't be fetched, along with the pages linking to it
+type BrokenLink struct {
+	URL string `json:"url"`
+	// Status is the HTTP status code the server replied with, 0 if it didn't reply
+	Status int `json:"status,omitempty"`
+	// Kind classifies the error, e.g. timeout or http status
+	Kind     string `json:"kind,omitempty"`
+	Error    string `json:"error"`
+	Attempts int    `json:"attempts,omitempty"`
+	// Sources are the pages linking to the URL, or redirecting to it, sorted
+	Sources []string `json:"sources"`
+}
+
+// String returns the broken link in a human readable format, e.g. /a (404), linked from /, /b
+func (b BrokenLink) String() string {
+	if len(b.Sources) == 0 {
+		return fmt.Sprintf("%s (%s), not linked from any page", b.URL, b.outcome())
+	}
+	return fmt.Sprintf("%s (%s), linked from %s", b.URL, b.outcome(), strings.Join(b.Sources, ", "))
+}
+
+// outcome returns the status code of a broken link, or the kind of error if the server didn't reply
+func (b BrokenLink) outcome() string {
+	if b.Status != 0 {
+		return fmt.Sprintf("%d", b.Status)
+	}
+	if b.Kind != "" {
+		return b.Kind
+	}
+	return "error"
+}
+
+// BrokenLinks returns the URLs of the sitemap which couldn't be fetched, sorted, each one with
+// every page linking to it. The sitemap is streamed and only the broken links are kept in memory.
+func BrokenLinks(r sitemap.Ranger) []BrokenLink {
+	sources := make(map[string]*BrokenLink, 0)
+	r.RangePages(func(p sitemap.Page) bool {
+		if p.Broken() {
+			sources[p.URL] = &BrokenLink{URL: p.URL, Status: p.Status, Kind: p.ErrorKind, Error: p.Error, Attempts: p.Attempts, Sources: []string{}}
+		}
+		return true
+	})
+	r.RangeLinks(func(url string, links []sitemap.Link) bool {
+		for _, l := range links {
+			if b, ok := sources[l.URL]; ok {
+				b.Sources = append(b.Sources, url)
+			}
+		}
+		return true
+	})
+
+	broken := make([]BrokenLink, 0, len(sources))
+	for _, b := range sources {
+		sort.Strings(b.Sources)
+		// a page can link to the same URL more than once
+		unique := b.Sources[:0]
+		for _, s := range b.Sources {
+			if len(unique) == 0 || unique[len(unique)-1] != s {
+				unique = append(unique, s)
+			}
+		}
+		b.Sources = unique
+		broken = append(broken, *b)
+	}
+	sort.Slice(broken, func(i, j int) bool { return broken[i].URL < broken[j].URL })
+	return broken
+}
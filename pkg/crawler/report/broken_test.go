@@ -0,0 +1,57 @@
+package report
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/amartorelli/millipedes/pkg/crawler/sitemap"
+)
+
+func TestBrokenLinks(t *testing.T) {
+	sm := sitemap.NewMemorySitemap()
+	sm.AddLinks("/", []sitemap.Link{{URL: "/a"}, {URL: "/missing"}, {URL: "/missing", Kind: "image"}, {URL: "/moved"}})
+	sm.AddLinks("/a", []sitemap.Link{{URL: "/missing"}, {URL: "/slow"}})
+	sm.AddLinks("/moved", []sitemap.Link{{URL: "/gone", Redirect: 301}})
+	for url, p := range map[string]sitemap.Page{
+		"/":        {Status: 200},
+		"/a":       {Status: 200},
+		"/missing": {Status: 404, Error: "/missing response code 404", ErrorKind: "http status", Attempts: 1},
+		"/moved":   {Status: 301},
+		"/gone":    {Status: 410, Error: "/gone response code 410", ErrorKind: "http status", Attempts: 1},
+		"/slow":    {Error: "error fetching /slow: timeout", ErrorKind: "timeout", Attempts: 3},
+		"/down":    {Error: "error fetching /down: connection refused", Attempts: 1},
+	} {
+		p := p
+		p.URL = url
+		sm.UpdatePage(url, func(page *sitemap.Page) { *page = p })
+	}
+
+	expected := []BrokenLink{
+		{URL: "/down", Error: "error fetching /down: connection refused", Attempts: 1, Sources: []string{}},
+		{URL: "/gone", Status: 410, Kind: "http status", Error: "/gone response code 410", Attempts: 1, Sources: []string{"/moved"}},
+		{URL: "/missing", Status: 404, Kind: "http status", Error: "/missing response code 404", Attempts: 1, Sources: []string{"/", "/a"}},
+		{URL: "/slow", Kind: "timeout", Error: "error fetching /slow: timeout", Attempts: 3, Sources: []string{"/a"}},
+	}
+	broken := BrokenLinks(sitemap.NewGraph(sm))
+	if !reflect.DeepEqual(broken, expected) {
+		t.Fatalf("expecting broken links %+v, got %+v", expected, broken)
+	}
+	// streamed from the sitemap rather than from a graph
+	if broken := BrokenLinks(sm); !reflect.DeepEqual(broken, expected) {
+		t.Fatalf("expecting the broken links streamed from the sitemap to be %+v, got %+v", expected, broken)
+	}
+
+	tt := []struct {
+		broken   BrokenLink
+		expected string
+	}{
+		{broken: expected[0], expected: "/down (error), not linked from any page"},
+		{broken: expected[2], expected: "/missing (404), linked from /, /a"},
+		{broken: expected[3], expected: "/slow (timeout), linked from /a"},
+	}
+	for _, tc := range tt {
+		if s := tc.broken.String(); s != tc.expected {
+			t.Errorf("expecting %q, got %q", tc.expected, s)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package report
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/amartorelli/millipedes/pkg/crawler/fetcher"
+)
+
+// CheckReport lists the broken links of a website grouped by the pages linking to them
+type CheckReport struct {
+	Website string `json:"website"`
+	// Broken is the number of broken URLs, each one can be linked from many pages
+	Broken int          `json:"broken"`
+	Pages  []PageReport `json:"pages"`
+}
+
+// PageReport lists the broken links of a page
+type PageReport struct {
+	URL   string       `json:"url"`
+	Links []BrokenLink `json:"links"`
+}
+
+// Failed returns true if a link checker fails on the broken link: a 4xx or 5xx response, a timeout
+// or another error reaching the URL. Pages too large to be downloaded aren't broken for a visitor.
+func (b BrokenLink) Failed() bool {
+	return b.Kind != string(fetcher.KindTooLarge)
+}
+
+// NewCheckReport returns the report of the broken links a link checker fails on, grouped by the pages
+// linking to them and sorted. The broken URLs which aren't linked from any page, e.g. the website
+// itself, are listed under their own URL.
+func NewCheckReport(website string, broken []BrokenLink) CheckReport {
+	r := CheckReport{Website: website, Pages: []PageReport{}}
+	pages := make(map[string][]BrokenLink, 0)
+	for _, b := range broken {
+		if !b.Failed() {
+			continue
+		}
+		r.Broken++
+		if len(b.Sources) == 0 {
+			pages[b.URL] = append(pages[b.URL], b)
+		}
+		for _, source := range b.Sources {
+			pages[source] = append(pages[source], b)
+		}
+	}
+	for url, links := range pages {
+		sort.Slice(links, func(i, j int) bool { return links[i].URL < links[j].URL })
+		r.Pages = append(r.Pages, PageReport{URL: url, Links: links})
+	}
+	sort.Slice(r.Pages, func(i, j int) bool { return r.Pages[i].URL < r.Pages[j].URL })
+	return r
+}
+
+// WriteText writes the report in a human readable format, one line per broken link under each page
+func (r CheckReport) WriteText(w io.Writer) error {
+	if r.Broken == 0 {
+		_, err := fmt.Fprintf(w, "no broken links found on %s\n", r.Website)
+		return err
+	}
+	for _, p := range r.Pages {
+		if _, err := fmt.Fprintln(w, p.URL); err != nil {
+			return err
+		}
+		for _, l := range p.Links {
+			if _, err := fmt.Fprintf(w, "  %-8s %s\n", l.outcome(), l.URL); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d broken links found on %s\n", r.Broken, r.Website)
+	return err
+}
+
+// WriteJSON writes the report as an indented JSON document
+func (r CheckReport) WriteJSON(w io.Writer) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// junitTestSuites is the root element of a JUnit XML report
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite holds the broken links of a page
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+// junitTestCase is a broken link of a page
+type junitTestCase struct {
+	ClassName string       `xml:"classname,attr"`
+	Name      string       `xml:"name,attr"`
+	Failure   junitFailure `xml:"failure"`
+}
+
+// junitFailure describes why a link is broken
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report in the JUnit XML format, so that CI systems can annotate the failures:
+// each page is a test suite with a failed test case for each of its broken links
+func (r CheckReport) WriteJUnit(w io.Writer) error {
+	suites := junitTestSuites{Name: r.Website, Suites: []junitTestSuite{}}
+	for _, p := range r.Pages {
+		suite := junitTestSuite{Name: p.URL, Tests: len(p.Links), Failures: len(p.Links)}
+		for _, l := range p.Links {
+			suite.Cases = append(suite.Cases, junitTestCase{
+				ClassName: p.URL,
+				Name:      l.URL,
+				Failure: junitFailure{
+					Message: fmt.Sprintf("%s %s", l.outcome(), l.URL),
+					Type:    l.Kind,
+					Text:    fmt.Sprintf("%s links to %s: %s", p.URL, l.URL, l.Error),
+				},
+			})
+		}
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Suites = append(suites.Suites, suite)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
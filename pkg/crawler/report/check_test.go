@@ -0,0 +1,101 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"reflect"
+	"testing"
+)
+
+// testBrokenLinks are broken links of a website, one of them only too large to be downloaded
+var testBrokenLinks = []BrokenLink{
+	{URL: "/down", Error: "connection refused", Attempts: 1, Sources: []string{}},
+	{URL: "/huge.pdf", Kind: "too large", Error: "body larger than 10 bytes", Attempts: 1, Sources: []string{"/"}},
+	{URL: "/missing", Status: 404, Kind: "http status", Error: "/missing response code 404", Attempts: 1, Sources: []string{"/", "/a"}},
+	{URL: "https://other.com/slow", Kind: "timeout", Error: "error fetching https://other.com/slow: timeout", Attempts: 3, Sources: []string{"/a"}},
+}
+
+func TestNewCheckReport(t *testing.T) {
+	r := NewCheckReport("https://example.com", testBrokenLinks)
+	expected := CheckReport{
+		Website: "https://example.com",
+		Broken:  3,
+		Pages: []PageReport{
+			{URL: "/", Links: []BrokenLink{testBrokenLinks[2]}},
+			{URL: "/a", Links: []BrokenLink{testBrokenLinks[2], testBrokenLinks[3]}},
+			{URL: "/down", Links: []BrokenLink{testBrokenLinks[0]}},
+		},
+	}
+	if !reflect.DeepEqual(r, expected) {
+		t.Fatalf("expecting report %+v, got %+v", expected, r)
+	}
+
+	var text bytes.Buffer
+	if err := r.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	expectedText := `/
+  404      /missing
+/a
+  404      /missing
+  timeout  https://other.com/slow
+/down
+  error    /down
+3 broken links found on https://example.com
+`
+	if text.String() != expectedText {
+		t.Errorf("expecting text report %q, got %q", expectedText, text.String())
+	}
+
+	text.Reset()
+	if err := NewCheckReport("https://example.com", nil).WriteText(&text); err != nil || text.String() != "no broken links found on https://example.com\n" {
+		t.Errorf("unexpected text report without broken links %q", text.String())
+	}
+}
+
+func TestCheckReportJSON(t *testing.T) {
+	r := NewCheckReport("https://example.com", testBrokenLinks)
+	var b bytes.Buffer
+	if err := r.WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+	var decoded CheckReport
+	if err := json.Unmarshal(b.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, r) {
+		t.Errorf("expecting the JSON report to decode to %+v, got %+v", r, decoded)
+	}
+}
+
+func TestCheckReportJUnit(t *testing.T) {
+	r := NewCheckReport("https://example.com", testBrokenLinks)
+	var b bytes.Buffer
+	if err := r.WriteJUnit(&b); err != nil {
+		t.Fatal(err)
+	}
+	var suites junitTestSuites
+	if err := xml.Unmarshal(b.Bytes(), &suites); err != nil {
+		t.Fatal(err)
+	}
+	if suites.Name != "https://example.com" || suites.Tests != 4 || suites.Failures != 4 || len(suites.Suites) != 3 {
+		t.Fatalf("unexpected test suites %+v", suites)
+	}
+	suite := suites.Suites[1]
+	if suite.Name != "/a" || suite.Tests != 2 || suite.Failures != 2 || len(suite.Cases) != 2 {
+		t.Fatalf("expecting a test suite for /a with 2 failures, got %+v", suite)
+	}
+	expected := junitTestCase{
+		ClassName: "/a",
+		Name:      "https://other.com/slow",
+		Failure: junitFailure{
+			Message: "timeout https://other.com/slow",
+			Type:    "timeout",
+			Text:    "/a links to https://other.com/slow: error fetching https://other.com/slow: timeout",
+		},
+	}
+	if !reflect.DeepEqual(suite.Cases[1], expected) {
+		t.Errorf("expecting test case %+v, got %+v", expected, suite.Cases[1])
+	}
+}
@@ -0,0 +1,125 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/amartorelli/millipedes/pkg/crawler/sitemap"
+)
+
+// RedirectChain is a sequence of redirects followed from a URL
+type RedirectChain struct {
+	// URLs are the URLs of the chain in order, from the first one to the final target
+	URLs []string
+	// Statuses are the status codes of the redirects, Statuses[i] redirecting from URLs[i] to URLs[i+1]
+	Statuses []int
+	// Loop is true if the last URL of the chain redirects to one of the previous ones
+	Loop bool
+}
+
+// Hops returns the number of redirects of the chain
+func (c RedirectChain) Hops() int {
+	return len(c.Statuses)
+}
+
+// String returns the chain in a human readable format, e.g. /a -301-> /b
+func (c RedirectChain) String() string {
+	var b strings.Builder
+	for i, u := range c.URLs {
+		if i > 0 {
+			fmt.Fprintf(&b, " -%d-> ", c.Statuses[i-1])
+		}
+		b.WriteString(u)
+	}
+	if c.Loop {
+		b.WriteString(" (loop)")
+	}
+	return b.String()
+}
+
+// redirectOf returns the redirect from a page, if any
+func redirectOf(links []sitemap.Link) (sitemap.Link, bool) {
+	for _, l := range links {
+		if l.Redirect != 0 {
+			return l, true
+		}
+	}
+	return sitemap.Link{}, false
+}
+
+// Redirects returns the redirect from each URL of the sitemap which redirects, in the format of
+// RedirectChains. The sitemap is streamed and only the redirects are kept in memory.
+func Redirects(r sitemap.Ranger) map[string][]sitemap.Link {
+	redirects := make(map[string][]sitemap.Link, 0)
+	r.RangeLinks(func(url string, links []sitemap.Link) bool {
+		if l, ok := redirectOf(links); ok {
+			redirects[url] = []sitemap.Link{l}
+		}
+		return true
+	})
+	return redirects
+}
+
+// RedirectChains returns the redirect chains of a sitemap, each one starting from a URL
+// which isn't the target of another redirect, sorted by their first URL
+func RedirectChains(links map[string][]sitemap.Link) []RedirectChain {
+	targets := make(map[string]struct{}, 0)
+	sources := []string{}
+	for url, ll := range links {
+		if l, ok := redirectOf(ll); ok {
+			targets[l.URL] = struct{}{}
+			sources = append(sources, url)
+		}
+	}
+	sort.Strings(sources)
+
+	chains := []RedirectChain{}
+	visited := make(map[string]struct{}, 0)
+	follow := func(start string) {
+		chain := RedirectChain{URLs: []string{start}}
+		inChain := map[string]struct{}{start: {}}
+		visited[start] = struct{}{}
+		url := start
+		for {
+			l, ok := redirectOf(links[url])
+			if !ok {
+				break
+			}
+			chain.URLs = append(chain.URLs, l.URL)
+			chain.Statuses = append(chain.Statuses, l.Redirect)
+			if _, ok := inChain[l.URL]; ok {
+				chain.Loop = true
+				break
+			}
+			inChain[l.URL] = struct{}{}
+			visited[l.URL] = struct{}{}
+			url = l.URL
+		}
+		chains = append(chains, chain)
+	}
+
+	for _, url := range sources {
+		if _, ok := targets[url]; !ok {
+			follow(url)
+		}
+	}
+	// loops that aren't reached from any other URL
+	for _, url := range sources {
+		if _, ok := visited[url]; !ok {
+			follow(url)
+		}
+	}
+	return chains
+}
+
+// FlagRedirectChains returns the chains which loop or have more than maxHops redirects
+func FlagRedirectChains(chains []RedirectChain, maxHops int) []RedirectChain {
+	flagged := []RedirectChain{}
+	for _, c := range chains {
+		if c.Loop || c.Hops() > maxHops {
+			flagged = append(flagged, c)
+		}
+	}
+	return flagged
+}
@@ -0,0 +1,50 @@
+package report
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/amartorelli/millipedes/pkg/crawler/sitemap"
+)
+
+func TestRedirectChains(t *testing.T) {
+	links := map[string][]sitemap.Link{
+		"/":      {{URL: "/old"}, {URL: "/loop"}, {URL: "/long"}},
+		"/old":   {{URL: "/new", Redirect: 301}},
+		"/new":   {{URL: "/"}},
+		"/loop":  {{URL: "/loop2", Redirect: 302}},
+		"/loop2": {{URL: "/loop", Redirect: 302}},
+		"/long":  {{URL: "/long2", Redirect: 301}},
+		"/long2": {{URL: "/long3", Redirect: 308}},
+		"/long3": {{URL: "/", Redirect: 301}},
+		"/self":  {{URL: "/self", Redirect: 307}},
+	}
+
+	expected := []RedirectChain{
+		{URLs: []string{"/long", "/long2", "/long3", "/"}, Statuses: []int{301, 308, 301}},
+		{URLs: []string{"/old", "/new"}, Statuses: []int{301}},
+		{URLs: []string{"/loop", "/loop2", "/loop"}, Statuses: []int{302, 302}, Loop: true},
+		{URLs: []string{"/self", "/self"}, Statuses: []int{307}, Loop: true},
+	}
+	chains := RedirectChains(links)
+	if !reflect.DeepEqual(chains, expected) {
+		t.Fatalf("expecting chains %v, got %v", expected, chains)
+	}
+
+	// streamed from a sitemap
+	sm := sitemap.NewMemorySitemap()
+	for url, ll := range links {
+		sm.AddLinks(url, ll)
+	}
+	if chains := RedirectChains(Redirects(sm)); !reflect.DeepEqual(chains, expected) {
+		t.Fatalf("expecting the chains of the redirects streamed from the sitemap to be %v, got %v", expected, chains)
+	}
+
+	flagged := FlagRedirectChains(chains, 2)
+	if !reflect.DeepEqual(flagged, []RedirectChain{expected[0], expected[2], expected[3]}) {
+		t.Errorf("expecting the long chain and the loops to be flagged, got %v", flagged)
+	}
+	if s := expected[2].String(); s != "/loop -302-> /loop2 -302-> /loop (loop)" {
+		t.Errorf("unexpected chain format %q", s)
+	}
+}
@@ -0,0 +1,102 @@
+package robots
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amartorelli/millipedes/pkg/crawler/fetcher"
+	"github.com/sirupsen/logrus"
+)
+
+// entry holds the robots.txt of a single host, fetched only once
+type entry struct {
+	once   sync.Once
+	robots *Robots
+}
+
+// Cache fetches robots.txt files through a Fetcher and caches them per host
+type Cache struct {
+	fetcher   fetcher.Fetcher
+	userAgent string
+	entries   map[string]*entry
+	entryMux  *sync.Mutex
+}
+
+// NewCache returns a new Cache evaluating rules for the given user agent
+func NewCache(fetcher fetcher.Fetcher, userAgent string) *Cache {
+	return &Cache{
+		fetcher:   fetcher,
+		userAgent: userAgent,
+		entries:   make(map[string]*entry, 0),
+		entryMux:  &sync.Mutex{},
+	}
+}
+
+// get returns the robots.txt rules for the host of the URL, fetching them the first time.
+// As RFC 9309 requires, everything is allowed if the file is unavailable (a 4xx response) and
+// nothing is if it's unreachable (a 5xx response, a timeout or another network error).
+func (c *Cache) get(u *url.URL) *Robots {
+	key := fmt.Sprintf("%s://%s", strings.ToLower(u.Scheme), strings.ToLower(u.Host))
+
+	c.entryMux.Lock()
+	e, ok := c.entries[key]
+	if !ok {
+		e = &entry{}
+		c.entries[key] = e
+	}
+	c.entryMux.Unlock()
+
+	e.once.Do(func() {
+		robotsURL := key + "/robots.txt"
+		resp, err := c.fetcher.Fetch(robotsURL)
+		if err != nil {
+			e.robots = &Robots{}
+			if unavailable(err) {
+				logrus.Debugf("no robots.txt for %s: %s", key, err)
+				return
+			}
+			logrus.Warnf("robots.txt of %s is unreachable, not crawling it: %s", key, err)
+			e.robots.disallowAll = true
+			return
+		}
+		e.robots = Parse(resp.Body)
+	})
+	return e.robots
+}
+
+// unavailable returns true if the error fetching robots.txt means that there's no file, rather
+// than that the server couldn't be reached: a 4xx response, or too many redirects
+func unavailable(err error) bool {
+	fe, ok := err.(*fetcher.Error)
+	if !ok {
+		return false
+	}
+	switch fe.Kind {
+	case fetcher.KindStatus:
+		return fe.StatusCode >= 400 && fe.StatusCode < 500
+	case fetcher.KindRedirect:
+		return true
+	}
+	return false
+}
+
+// Allowed returns true if the URL can be crawled according to the robots.txt of its host
+func (c *Cache) Allowed(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	return c.get(u).Allowed(c.userAgent, u.RequestURI())
+}
+
+// CrawlDelay returns the Crawl-delay that applies to the host of the URL
+func (c *Cache) CrawlDelay(uri string) time.Duration {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return 0
+	}
+	return c.get(u).CrawlDelay(c.userAgent)
+}
@@ -0,0 +1,62 @@
+package robots
+
+import "strings"
+
+// Directives are the indexing directives of a page, set with <meta name="robots"> or X-Robots-Tag
+type Directives struct {
+	// NoIndex asks not to index the page
+	NoIndex bool
+	// NoFollow asks not to follow the links of the page
+	NoFollow bool
+}
+
+// Merge returns the directives set either in d or in o
+func (d Directives) Merge(o Directives) Directives {
+	return Directives{NoIndex: d.NoIndex || o.NoIndex, NoFollow: d.NoFollow || o.NoFollow}
+}
+
+// ParseDirectives parses a comma separated list of directives, e.g. "noindex, nofollow"
+func ParseDirectives(content string) Directives {
+	var d Directives
+	for _, directive := range strings.Split(content, ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "noindex":
+			d.NoIndex = true
+		case "nofollow":
+			d.NoFollow = true
+		case "none":
+			d.NoIndex = true
+			d.NoFollow = true
+		}
+	}
+	return d
+}
+
+// ParseHeader parses the values of the X-Robots-Tag header. Values can be prefixed by a user
+// agent, e.g. "googlebot: noindex", in which case they only apply if it matches userAgent.
+func ParseHeader(values []string, userAgent string) Directives {
+	var d Directives
+	for _, v := range values {
+		if i := strings.Index(v, ":"); i >= 0 {
+			agent := strings.ToLower(strings.TrimSpace(v[:i]))
+			// directives with a value, e.g. unavailable_after: <date>, aren't user agents
+			if !strings.ContainsAny(agent, " ,") && !isValueDirective(agent) {
+				if agent != productToken(userAgent) {
+					continue
+				}
+				v = v[i+1:]
+			}
+		}
+		d = d.Merge(ParseDirectives(v))
+	}
+	return d
+}
+
+// isValueDirective returns true for the directives which are followed by a value
+func isValueDirective(name string) bool {
+	switch name {
+	case "unavailable_after", "max-snippet", "max-image-preview", "max-video-preview":
+		return true
+	}
+	return false
+}
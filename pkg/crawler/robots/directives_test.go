@@ -0,0 +1,47 @@
+package robots
+
+import "testing"
+
+func TestParseDirectives(t *testing.T) {
+	tt := []struct {
+		content    string
+		directives Directives
+	}{
+		{"", Directives{}},
+		{"index, follow", Directives{}},
+		{"noindex", Directives{NoIndex: true}},
+		{"NOINDEX,NOFOLLOW", Directives{NoIndex: true, NoFollow: true}},
+		{" nofollow , noarchive", Directives{NoFollow: true}},
+		{"none", Directives{NoIndex: true, NoFollow: true}},
+	}
+
+	for _, tc := range tt {
+		d := ParseDirectives(tc.content)
+		if d != tc.directives {
+			t.Errorf("expecting %q to be %+v, got %+v", tc.content, tc.directives, d)
+		}
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	tt := []struct {
+		values     []string
+		directives Directives
+	}{
+		{nil, Directives{}},
+		{[]string{"noindex"}, Directives{NoIndex: true}},
+		{[]string{"noindex", "nofollow"}, Directives{NoIndex: true, NoFollow: true}},
+		{[]string{"googlebot: noindex"}, Directives{}},
+		{[]string{"millipedes: nofollow"}, Directives{NoFollow: true}},
+		{[]string{"Millipedes: noindex", "otherbot: nofollow"}, Directives{NoIndex: true}},
+		{[]string{"unavailable_after: 25 Jun 2010 15:00:00 PST"}, Directives{}},
+		{[]string{"noindex, unavailable_after: 25 Jun 2010 15:00:00 PST"}, Directives{NoIndex: true}},
+	}
+
+	for _, tc := range tt {
+		d := ParseHeader(tc.values, "millipedes/1.0")
+		if d != tc.directives {
+			t.Errorf("expecting %q to be %+v, got %+v", tc.values, tc.directives, d)
+		}
+	}
+}
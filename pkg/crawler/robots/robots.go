@@ -0,0 +1,182 @@
+package robots
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Robots represents a parsed robots.txt file
+type Robots struct {
+	groups []*group
+	// disallowAll is set when robots.txt is unreachable, e.g. the server replied with a 5xx
+	disallowAll bool
+}
+
+// group is a set of rules that apply to one or more user agents
+type group struct {
+	agents     []string
+	rules      []rule
+	crawlDelay time.Duration
+}
+
+// rule is a single Allow or Disallow line
+type rule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+// newRule compiles a robots.txt path pattern supporting the * wildcard and the $ end anchor
+func newRule(allow bool, pattern string) rule {
+	anchored := strings.HasSuffix(pattern, "$")
+	p := strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(p, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return rule{allow: allow, pattern: pattern, re: regexp.MustCompile(expr)}
+}
+
+// Parse parses the content of a robots.txt file. Unknown or malformed lines are ignored.
+func Parse(r io.Reader) *Robots {
+	robots := &Robots{groups: make([]*group, 0)}
+	var current *group
+	inRules := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		value := strings.TrimSpace(kv[1])
+
+		switch key {
+		case "user-agent":
+			// a user-agent line after some rules starts a new group
+			if current == nil || inRules {
+				current = &group{}
+				robots.groups = append(robots.groups, current)
+				inRules = false
+			}
+			current.agents = append(current.agents, productToken(value))
+		case "allow", "disallow":
+			if current == nil {
+				continue
+			}
+			inRules = true
+			// an empty Disallow means everything is allowed
+			if value == "" {
+				continue
+			}
+			current.rules = append(current.rules, newRule(key == "allow", value))
+		case "crawl-delay":
+			if current == nil {
+				continue
+			}
+			inRules = true
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds < 0 {
+				continue
+			}
+			current.crawlDelay = time.Duration(seconds * float64(time.Second))
+		}
+	}
+	return robots
+}
+
+// productToken returns the lowercase name of a user agent without its version
+func productToken(userAgent string) string {
+	token := strings.ToLower(strings.TrimSpace(userAgent))
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+	return token
+}
+
+// groupFor merges all the groups that match the product token of the user agent, compared
+// without case. The * group is only used when no other group matches.
+func (r *Robots) groupFor(userAgent string) *group {
+	token := productToken(userAgent)
+	best := ""
+	found := false
+	for _, g := range r.groups {
+		for _, a := range g.agents {
+			if a == token {
+				best, found = a, true
+			} else if a == "*" && !found {
+				best, found = a, true
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	merged := &group{agents: []string{best}}
+	for _, g := range r.groups {
+		for _, a := range g.agents {
+			if a == best {
+				merged.rules = append(merged.rules, g.rules...)
+				if g.crawlDelay > merged.crawlDelay {
+					merged.crawlDelay = g.crawlDelay
+				}
+				break
+			}
+		}
+	}
+	return merged
+}
+
+// Allowed returns true if the user agent is allowed to fetch the path. The path should include
+// the query string, if any. The longest matching rule wins and Allow wins over Disallow on ties.
+func (r *Robots) Allowed(userAgent, path string) bool {
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+	if r.disallowAll {
+		return false
+	}
+	g := r.groupFor(userAgent)
+	if g == nil {
+		return true
+	}
+
+	allowed := true
+	longest := -1
+	for _, rl := range g.rules {
+		if !rl.re.MatchString(path) {
+			continue
+		}
+		if len(rl.pattern) > longest || (len(rl.pattern) == longest && rl.allow) {
+			longest = len(rl.pattern)
+			allowed = rl.allow
+		}
+	}
+	return allowed
+}
+
+// CrawlDelay returns the Crawl-delay set for the user agent, or 0 if not set
+func (r *Robots) CrawlDelay(userAgent string) time.Duration {
+	g := r.groupFor(userAgent)
+	if g == nil {
+		return 0
+	}
+	return g.crawlDelay
+}
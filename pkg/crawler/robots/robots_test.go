@@ -0,0 +1,181 @@
+package robots
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amartorelli/millipedes/pkg/crawler/fetcher"
+)
+
+var robotsTxt = `
+# comments are ignored
+User-agent: *
+Disallow: /private/
+Allow: /private/public.html
+Disallow: /*.pdf$
+Disallow: /search?
+
+User-agent: millipedes
+User-agent: otherbot
+Disallow: /nomillipedes
+Crawl-delay: 2
+
+User-agent: millipedes
+Allow: /nomillipedes/but-this
+
+User-agent: emptybot
+Disallow:
+`
+
+func TestAllowed(t *testing.T) {
+	r := Parse(strings.NewReader(robotsTxt))
+
+	tt := []struct {
+		agent   string
+		path    string
+		allowed bool
+	}{
+		{"somebot", "/", true},
+		{"somebot", "/private/", false},
+		{"somebot", "/private/page.html", false},
+		{"somebot", "/private/public.html", true},
+		{"somebot", "/docs/file.pdf", false},
+		{"somebot", "/docs/file.pdf?download=1", true},
+		{"somebot", "/search?q=test", false},
+		{"somebot", "/search", true},
+		{"somebot", "/robots.txt", true},
+		{"millipedes/1.0", "/private/", true},
+		{"millipedes/1.0", "/nomillipedes", false},
+		{"Millipedes", "/nomillipedes/page", false},
+		{"millipedes", "/nomillipedes/but-this", true},
+		{"otherbot", "/nomillipedes/but-this", false},
+		{"emptybot", "/private/", true},
+	}
+
+	for _, tc := range tt {
+		allowed := r.Allowed(tc.agent, tc.path)
+		if allowed != tc.allowed {
+			t.Errorf("expecting %s allowed for %s to be %v, got %v", tc.path, tc.agent, tc.allowed, allowed)
+		}
+	}
+}
+
+func TestCrawlDelay(t *testing.T) {
+	r := Parse(strings.NewReader(robotsTxt))
+
+	tt := []struct {
+		agent string
+		delay time.Duration
+	}{
+		{"somebot", 0},
+		{"millipedes", 2 * time.Second},
+		{"otherbot", 2 * time.Second},
+	}
+
+	for _, tc := range tt {
+		delay := r.CrawlDelay(tc.agent)
+		if delay != tc.delay {
+			t.Errorf("expecting crawl delay for %s to be %s, got %s", tc.agent, tc.delay, delay)
+		}
+	}
+}
+
+func TestGroupFor(t *testing.T) {
+	r := Parse(strings.NewReader(`
+User-agent: m
+User-agent: bot
+Disallow: /short
+
+User-agent: Millipedes/2.0
+Disallow: /versioned
+
+User-agent: *
+Disallow: /all
+`))
+
+	tt := []struct {
+		agent   string
+		path    string
+		allowed bool
+	}{
+		{"millipedes", "/short", true},
+		{"millipedes", "/versioned", false},
+		{"millipedes", "/all", true},
+		{"MILLIPEDES/1.0", "/versioned", false},
+		{"M", "/short", false},
+		{"somebot", "/short", true},
+		{"somebot", "/all", false},
+	}
+
+	for _, tc := range tt {
+		allowed := r.Allowed(tc.agent, tc.path)
+		if allowed != tc.allowed {
+			t.Errorf("expecting %s allowed for %s to be %v, got %v", tc.path, tc.agent, tc.allowed, allowed)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	f := fetcher.NewMockFetcher(map[string][]byte{
+		"https://example.com/robots.txt": []byte(robotsTxt),
+	})
+	c := NewCache(f, "millipedes")
+
+	tt := []struct {
+		uri     string
+		allowed bool
+	}{
+		{"https://example.com/", true},
+		{"https://example.com/nomillipedes", false},
+		{"https://example.com/nomillipedes/but-this", true},
+		// no robots.txt for this host, so everything is allowed
+		{"https://community.example.com/nomillipedes", true},
+	}
+
+	for _, tc := range tt {
+		allowed := c.Allowed(tc.uri)
+		if allowed != tc.allowed {
+			t.Errorf("expecting %s allowed to be %v, got %v", tc.uri, tc.allowed, allowed)
+		}
+	}
+
+	if d := c.CrawlDelay("https://example.com/"); d != 2*time.Second {
+		t.Errorf("expecting crawl delay to be 2s, got %s", d)
+	}
+}
+
+// errorFetcher fails to fetch every URL with the same error
+type errorFetcher struct {
+	err error
+}
+
+func (f *errorFetcher) Fetch(url string) (*fetcher.Response, error) {
+	return nil, f.err
+}
+
+func TestCacheErrors(t *testing.T) {
+	tt := []struct {
+		err     error
+		allowed bool
+	}{
+		{err: &fetcher.Error{Kind: fetcher.KindStatus, StatusCode: 404}, allowed: true},
+		{err: &fetcher.Error{Kind: fetcher.KindStatus, StatusCode: 403}, allowed: true},
+		{err: &fetcher.Error{Kind: fetcher.KindRedirect}, allowed: true},
+		{err: &fetcher.Error{Kind: fetcher.KindStatus, StatusCode: 503}},
+		{err: &fetcher.Error{Kind: fetcher.KindTimeout}},
+		{err: &fetcher.Error{Kind: fetcher.KindNetwork}},
+		{err: errors.New("unknown error")},
+	}
+
+	for _, tc := range tt {
+		c := NewCache(&errorFetcher{err: tc.err}, "millipedes")
+		if allowed := c.Allowed("https://example.com/page"); allowed != tc.allowed {
+			t.Errorf("expecting a page to be allowed %v when robots.txt fails with %v, got %v", tc.allowed, tc.err, allowed)
+		}
+		if !c.Allowed("https://example.com/robots.txt") {
+			t.Errorf("expecting robots.txt to be always allowed")
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package scheduler
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amartorelli/millipedes/pkg/crawler/frontier"
+)
+
+// host holds the politeness state of a single host
+type host struct {
+	queue      []frontier.Item
+	overflow   frontier.Frontier
+	tokens     float64
+	refilled   time.Time
+	inflight   int
+	crawlDelay time.Duration
+	notBefore  time.Time
+}
+
+// Scheduler hands out the URLs of a frontier to the workers. Each host has its own token
+// bucket and maximum number of concurrent requests, and hosts are served in rotation so
+// that a slow host doesn't starve the others.
+type Scheduler struct {
+	frontier       frontier.Frontier
+	interval       time.Duration
+	burst          int
+	maxConcurrency int
+	lookahead      int
+	hosts          map[string]*host
+	ring           []string
+	next           int
+	buffered       int
+	overflowed     int
+	wake           chan struct{}
+	mux            *sync.Mutex
+	now            func() time.Time
+}
+
+// New returns a new Scheduler. Each host can be fetched once every interval with bursts of up to
+// burst requests, and at most maxConcurrency requests at a time. lookahead is the number of URLs
+// moved from the frontier to the per-host queues ahead of time, of which each host keeps at most
+// burst in memory.
+func New(f frontier.Frontier, interval time.Duration, burst, maxConcurrency, lookahead int) *Scheduler {
+	if burst < 1 {
+		burst = 1
+	}
+	if lookahead < 1 {
+		lookahead = 1
+	}
+	return &Scheduler{
+		frontier:       f,
+		interval:       interval,
+		burst:          burst,
+		maxConcurrency: maxConcurrency,
+		lookahead:      lookahead,
+		hosts:          make(map[string]*host, 0),
+		ring:           make([]string, 0),
+		wake:           make(chan struct{}),
+		mux:            &sync.Mutex{},
+		now:            time.Now,
+	}
+}
+
+// hostKey returns the key of the host of a URL
+func hostKey(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
+
+// getHost returns the state of a host, creating it with a full bucket if needed
+func (s *Scheduler) getHost(key string) *host {
+	h, ok := s.hosts[key]
+	if !ok {
+		h = &host{tokens: float64(s.burst), refilled: s.now()}
+		s.hosts[key] = h
+	}
+	return h
+}
+
+// signal wakes up all the workers waiting in Next
+func (s *Scheduler) signal() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+// Push adds an item to the frontier
+func (s *Scheduler) Push(item frontier.Item) error {
+	err := s.frontier.Push(item)
+	if err != nil {
+		return err
+	}
+	s.mux.Lock()
+	s.signal()
+	s.mux.Unlock()
+	return nil
+}
+
+// Len returns the number of items waiting to be scheduled
+func (s *Scheduler) Len() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.frontier.Len() + s.buffered + s.overflowed
+}
+
+// SetCrawlDelay sets the minimum delay between two requests to a host, as requested by robots.txt
+func (s *Scheduler) SetCrawlDelay(hostname string, delay time.Duration) {
+	s.mux.Lock()
+	s.getHost(strings.ToLower(hostname)).crawlDelay = delay
+	s.mux.Unlock()
+}
+
+// Backoff stops sending requests to a host for the given duration, e.g. after a 429 or 503 response
+func (s *Scheduler) Backoff(hostname string, d time.Duration) {
+	s.mux.Lock()
+	h := s.getHost(strings.ToLower(hostname))
+	until := s.now().Add(d)
+	if until.After(h.notBefore) {
+		h.notBefore = until
+	}
+	s.mux.Unlock()
+}
+
+// buffer moves an item from the frontier to the queue of its host. Once the host has burst items
+// in memory the others go to its overflow, which spills to disk, so that the URLs of a host which
+// isn't ready don't hide the ones of the other hosts. It returns false if the frontier is empty.
+func (s *Scheduler) buffer() (bool, error) {
+	item, err := s.frontier.Pop()
+	if err == frontier.ErrEmpty {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	key := hostKey(item.URL)
+	h := s.getHost(key)
+	if len(h.queue) >= s.burst {
+		if h.overflow == nil {
+			h.overflow = frontier.NewSpillFrontier(s.lookahead, "")
+		}
+		err = h.overflow.Push(item)
+		if err != nil {
+			return false, err
+		}
+		s.overflowed++
+		return true, nil
+	}
+	if len(h.queue) == 0 {
+		s.ring = append(s.ring, key)
+	}
+	h.queue = append(h.queue, item)
+	s.buffered++
+	return true, nil
+}
+
+// refill moves the oldest item of the overflow of a host to its queue
+func (s *Scheduler) refill(h *host) error {
+	if h.overflow == nil || h.overflow.Len() == 0 {
+		return nil
+	}
+	item, err := h.overflow.Pop()
+	if err != nil {
+		return err
+	}
+	h.queue = append(h.queue, item)
+	s.overflowed--
+	s.buffered++
+	return nil
+}
+
+// readyIn returns how long until the host can be fetched. It returns ok false when the host
+// is waiting for a request to complete, since that doesn't depend on time.
+func (s *Scheduler) readyIn(h *host, now time.Time) (time.Duration, bool) {
+	if s.maxConcurrency > 0 && h.inflight >= s.maxConcurrency {
+		return 0, false
+	}
+
+	interval, burst := s.interval, float64(s.burst)
+	if h.crawlDelay > interval {
+		interval, burst = h.crawlDelay, 1
+	}
+	if interval > 0 {
+		h.tokens += float64(now.Sub(h.refilled)) / float64(interval)
+	} else {
+		h.tokens = burst
+	}
+	if h.tokens > burst {
+		h.tokens = burst
+	}
+	h.refilled = now
+
+	wait := h.notBefore.Sub(now)
+	if h.tokens < 1 {
+		if refill := time.Duration((1 - h.tokens) * float64(interval)); refill > wait {
+			wait = refill
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, true
+}
+
+// pick returns the first item of the next ready host in rotation, or how long to wait
+// for one. Items are moved from the frontier to the queues of their hosts until lookahead
+// of them are in memory, so that the URLs of hosts which aren't ready stay in the frontier
+// or in the overflow of their host, which can spill them to disk, rather than piling up in
+// memory.
+func (s *Scheduler) pick() (frontier.Item, string, time.Duration, bool, error) {
+	for s.buffered < s.lookahead {
+		ok, err := s.buffer()
+		if err != nil {
+			return frontier.Item{}, "", 0, false, err
+		}
+		if !ok {
+			break
+		}
+	}
+
+	now := s.now()
+	wait := time.Duration(-1)
+	for i := 0; i < len(s.ring); i++ {
+		idx := (s.next + i) % len(s.ring)
+		key := s.ring[idx]
+		h := s.hosts[key]
+		in, ok := s.readyIn(h, now)
+		if !ok {
+			continue
+		}
+		if in > 0 {
+			if wait < 0 || in < wait {
+				wait = in
+			}
+			continue
+		}
+
+		err := s.refill(h)
+		if err != nil {
+			return frontier.Item{}, "", 0, false, err
+		}
+		item := h.queue[0]
+		h.queue = h.queue[1:]
+		h.tokens--
+		h.inflight++
+		s.buffered--
+		if len(h.queue) == 0 {
+			s.ring = append(s.ring[:idx], s.ring[idx+1:]...)
+			s.next = idx
+		} else {
+			s.next = idx + 1
+		}
+		if len(s.ring) > 0 {
+			s.next %= len(s.ring)
+		} else {
+			s.next = 0
+		}
+		return item, key, 0, true, nil
+	}
+	return frontier.Item{}, "", wait, false, nil
+}
+
+// Next blocks until an item can be fetched and returns it, together with a function that
+// must be called once the item has been fetched to release the host.
+func (s *Scheduler) Next(ctx context.Context) (frontier.Item, func(), error) {
+	for {
+		s.mux.Lock()
+		item, key, wait, ok, err := s.pick()
+		wake := s.wake
+		s.mux.Unlock()
+		if err != nil {
+			return frontier.Item{}, nil, err
+		}
+		if ok {
+			return item, s.releaseFunc(key), nil
+		}
+
+		// without a wait time only a new item or a completed request can make a host ready
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait >= 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-wake:
+		case <-timeout:
+		case <-ctx.Done():
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return frontier.Item{}, nil, ctx.Err()
+		}
+	}
+}
+
+// releaseFunc returns a function releasing a concurrency slot of the host, only once
+func (s *Scheduler) releaseFunc(key string) func() {
+	once := &sync.Once{}
+	return func() {
+		once.Do(func() {
+			s.mux.Lock()
+			s.hosts[key].inflight--
+			s.signal()
+			s.mux.Unlock()
+		})
+	}
+}
+
+// Close discards the items left in the overflows of the hosts. The frontier is left open.
+func (s *Scheduler) Close() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var err error
+	for _, h := range s.hosts {
+		if h.overflow == nil {
+			continue
+		}
+		if closeErr := h.overflow.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
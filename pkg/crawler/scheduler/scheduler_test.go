@@ -0,0 +1,172 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/amartorelli/millipedes/pkg/crawler/frontier"
+)
+
+// next returns the URL of the next item, failing if none is ready within the timeout
+func next(s *Scheduler, timeout time.Duration) (string, func()) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	item, release, err := s.Next(ctx)
+	if err != nil {
+		return "", nil
+	}
+	return item.URL, release
+}
+
+func push(t *testing.T, s *Scheduler, urls ...string) {
+	for _, u := range urls {
+		if err := s.Push(frontier.Item{URL: u}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRotation(t *testing.T) {
+	s := New(frontier.NewSpillFrontier(100, ""), 0, 1, 0, 100)
+	push(t, s, "https://a.example.com/1", "https://a.example.com/2", "https://a.example.com/3", "https://b.example.com/1", "https://b.example.com/2")
+
+	expected := []string{
+		"https://a.example.com/1",
+		"https://b.example.com/1",
+		"https://a.example.com/2",
+		"https://b.example.com/2",
+		"https://a.example.com/3",
+	}
+	for _, e := range expected {
+		u, _ := next(s, time.Second)
+		if u != e {
+			t.Errorf("expecting %s, got %s", e, u)
+		}
+	}
+	if s.Len() != 0 {
+		t.Errorf("expecting nothing left to schedule, got %d", s.Len())
+	}
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	// the lookahead reaches past the URLs of the busy host
+	s := New(frontier.NewSpillFrontier(100, ""), 0, 1, 1, 4)
+	push(t, s, "https://slow.example.com/1", "https://slow.example.com/2", "https://slow.example.com/3", "https://fast.example.com/1")
+
+	u, release := next(s, time.Second)
+	if u != "https://slow.example.com/1" {
+		t.Fatalf("expecting https://slow.example.com/1, got %s", u)
+	}
+	// the slow host is busy, so the fast one must be served even if queued after it
+	u, releaseFast := next(s, time.Second)
+	if u != "https://fast.example.com/1" {
+		t.Fatalf("expecting https://fast.example.com/1, got %s", u)
+	}
+	releaseFast()
+	if u, _ := next(s, 50*time.Millisecond); u != "" {
+		t.Fatalf("expecting no host to be ready while the slow host is busy, got %s", u)
+	}
+
+	release()
+	// releasing twice must not free two slots
+	release()
+	u, _ = next(s, time.Second)
+	if u != "https://slow.example.com/2" {
+		t.Fatalf("expecting https://slow.example.com/2 once the host is released, got %s", u)
+	}
+	if u, _ := next(s, 50*time.Millisecond); u != "" {
+		t.Fatalf("expecting a single request to the slow host at a time, got %s", u)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	interval := 100 * time.Millisecond
+	s := New(frontier.NewSpillFrontier(100, ""), interval, 1, 0, 100)
+	push(t, s, "https://a.example.com/1", "https://a.example.com/2", "https://b.example.com/1")
+
+	start := time.Now()
+	for _, e := range []string{"https://a.example.com/1", "https://b.example.com/1", "https://a.example.com/2"} {
+		u, _ := next(s, time.Second)
+		if u != e {
+			t.Errorf("expecting %s, got %s", e, u)
+		}
+	}
+	// the second request to a.example.com must wait for its bucket to refill, b.example.com has its own
+	if elapsed := time.Since(start); elapsed < interval-10*time.Millisecond {
+		t.Errorf("expecting the second request to the same host to wait %s, waited %s", interval, elapsed)
+	}
+}
+
+func TestCrawlDelayAndBackoff(t *testing.T) {
+	s := New(frontier.NewSpillFrontier(100, ""), 0, 1, 0, 100)
+	s.SetCrawlDelay("a.example.com", time.Hour)
+	s.Backoff("b.example.com", time.Hour)
+	push(t, s, "https://a.example.com/1", "https://a.example.com/2", "https://b.example.com/1", "https://c.example.com/1")
+
+	for _, e := range []string{"https://a.example.com/1", "https://c.example.com/1"} {
+		u, _ := next(s, time.Second)
+		if u != e {
+			t.Errorf("expecting %s, got %s", e, u)
+		}
+	}
+	if u, _ := next(s, 50*time.Millisecond); u != "" {
+		t.Errorf("expecting the Crawl-delay and Retry-After to hold back the remaining URLs, got %s", u)
+	}
+}
+
+func TestLookahead(t *testing.T) {
+	f := frontier.NewSpillFrontier(10, "")
+	defer f.Close()
+	s := New(f, time.Hour, 1, 0, 5)
+	for i := 0; i < 1000; i++ {
+		push(t, s, fmt.Sprintf("https://a.example.com/%d", i))
+	}
+
+	if u, _ := next(s, time.Second); u != "https://a.example.com/0" {
+		t.Fatalf("expecting https://a.example.com/0, got %s", u)
+	}
+	// the host is rate limited, its URLs must wait in its overflow instead of being buffered in memory
+	if u, _ := next(s, 50*time.Millisecond); u != "" {
+		t.Fatalf("expecting the rate limit to hold back the remaining URLs, got %s", u)
+	}
+	if s.buffered > 5 {
+		t.Errorf("expecting at most 5 URLs buffered in memory, got %d", s.buffered)
+	}
+	if s.Len() != 999 {
+		t.Errorf("expecting 999 URLs left to schedule, got %d", s.Len())
+	}
+	if err := s.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLookaheadDelayedHost(t *testing.T) {
+	f := frontier.NewSpillFrontier(100, "")
+	defer f.Close()
+	s := New(f, 0, 1, 0, 4)
+	defer s.Close()
+	s.SetCrawlDelay("slow.example.com", 3600*time.Second)
+	for i := 0; i < 20; i++ {
+		push(t, s, fmt.Sprintf("https://slow.example.com/%d", i))
+	}
+	push(t, s, "https://fast.example.com/1")
+
+	if u, _ := next(s, time.Second); u != "https://slow.example.com/0" {
+		t.Fatalf("expecting https://slow.example.com/0, got %s", u)
+	}
+	// the URLs of the delayed host must not fill the lookahead and hide the fast host
+	if u, _ := next(s, time.Second); u != "https://fast.example.com/1" {
+		t.Fatalf("expecting https://fast.example.com/1, got %s", u)
+	}
+	if u, _ := next(s, 50*time.Millisecond); u != "" {
+		t.Fatalf("expecting the Crawl-delay to hold back the remaining URLs, got %s", u)
+	}
+	if s.buffered > 4 {
+		t.Errorf("expecting at most 4 URLs buffered in memory, got %d", s.buffered)
+	}
+	if s.Len() != 19 {
+		t.Errorf("expecting 19 URLs left to schedule, got %d", s.Len())
+	}
+}
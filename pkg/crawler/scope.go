@@ -0,0 +1,160 @@
+package crawler
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// ScopeMode is the rule used to decide which hosts belong to the crawl
+type ScopeMode int
+
+const (
+	// ScopeSubdomains accepts the entrypoint host and its subdomains
+	ScopeSubdomains ScopeMode = iota
+	// ScopeExactHost only accepts the entrypoint host
+	ScopeExactHost
+	// ScopeRegistrableDomain accepts every host under the registrable domain of the entrypoint,
+	// e.g. example.com and all its subdomains when starting from www.example.com
+	ScopeRegistrableDomain
+	// ScopeAllowlist accepts the entrypoint host and the hosts of the allowlist
+	ScopeAllowlist
+)
+
+var scopeModeNames = map[ScopeMode]string{
+	ScopeSubdomains:        "subdomains",
+	ScopeExactHost:         "host",
+	ScopeRegistrableDomain: "domain",
+	ScopeAllowlist:         "allowlist",
+}
+
+// String returns the name of the mode
+func (m ScopeMode) String() string {
+	return scopeModeNames[m]
+}
+
+// ParseScopeMode returns the mode matching a name: host, subdomains, domain or allowlist
+func ParseScopeMode(name string) (ScopeMode, error) {
+	for m, n := range scopeModeNames {
+		if n == name {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown scope mode %q", name)
+}
+
+// ScopePolicy defines which URLs belong to the crawl. The zero value accepts the entrypoint
+// host and its subdomains with any port over both http and https.
+type ScopePolicy struct {
+	Mode ScopeMode
+	// Hosts are the hosts accepted by ScopeAllowlist. An entry starting with a dot,
+	// like .example.com, accepts the subdomains of that host too.
+	Hosts []string
+	// MatchScheme only accepts URLs with the same scheme as the entrypoint
+	MatchScheme bool
+	// MatchPort only accepts URLs with the same port as the entrypoint, default ports included
+	MatchPort bool
+}
+
+// scope is a ScopePolicy compiled for an entrypoint
+type scope struct {
+	policy ScopePolicy
+	scheme string
+	port   string
+	base   string
+	hosts  []string
+}
+
+// normaliseHost lowercases a host and removes its trailing dot
+func normaliseHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// effectivePort returns the port of the URL, or the default port of its scheme
+func effectivePort(u *url.URL) string {
+	if p := u.Port(); p != "" {
+		return p
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return ""
+}
+
+// newScope compiles a policy for the entrypoint
+func newScope(entrypoint *url.URL, policy ScopePolicy) (*scope, error) {
+	host := normaliseHost(entrypoint.Hostname())
+	if host == "" {
+		return nil, fmt.Errorf("no host in entrypoint %s", entrypoint)
+	}
+
+	s := &scope{
+		policy: policy,
+		scheme: strings.ToLower(entrypoint.Scheme),
+		port:   effectivePort(entrypoint),
+		base:   host,
+		hosts:  []string{host},
+	}
+
+	switch policy.Mode {
+	case ScopeRegistrableDomain:
+		// IP addresses and hosts like localhost have no registrable domain
+		if net.ParseIP(host) == nil {
+			domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+			if err == nil {
+				s.base = domain
+			}
+		}
+	case ScopeAllowlist:
+		for _, h := range policy.Hosts {
+			s.hosts = append(s.hosts, normaliseHost(h))
+		}
+	case ScopeSubdomains, ScopeExactHost:
+	default:
+		return nil, fmt.Errorf("unknown scope mode %d", policy.Mode)
+	}
+	return s, nil
+}
+
+// isSubdomain returns true if host is domain or one of its subdomains, on a dot boundary
+func isSubdomain(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// contains returns true if the URL belongs to the scope
+func (s *scope) contains(u *url.URL) bool {
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return false
+	}
+	if s.policy.MatchScheme && scheme != s.scheme {
+		return false
+	}
+	if s.policy.MatchPort && effectivePort(u) != s.port {
+		return false
+	}
+
+	host := normaliseHost(u.Hostname())
+	if host == "" {
+		return false
+	}
+	switch s.policy.Mode {
+	case ScopeExactHost:
+		return host == s.base
+	case ScopeAllowlist:
+		for _, h := range s.hosts {
+			if host == h || (strings.HasPrefix(h, ".") && isSubdomain(host, h[1:])) {
+				return true
+			}
+		}
+		return false
+	default:
+		return isSubdomain(host, s.base)
+	}
+}
@@ -0,0 +1,91 @@
+package crawler
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestScopeContains(t *testing.T) {
+	tt := []struct {
+		entrypoint string
+		policy     ScopePolicy
+		uri        string
+		res        bool
+	}{
+		// subdomains, the default
+		{"https://example.com", ScopePolicy{}, "https://example.com/page", true},
+		{"https://example.com", ScopePolicy{}, "https://community.example.com", true},
+		{"https://example.com", ScopePolicy{}, "https://EXAMPLE.com./page", true},
+		{"https://example.com", ScopePolicy{}, "https://notexample.com", false},
+		{"https://example.com", ScopePolicy{}, "https://example.com.evil.com", false},
+		{"https://www.example.com", ScopePolicy{}, "https://example.com", false},
+		{"https://example.com", ScopePolicy{}, "mailto:info@example.com", false},
+		{"https://example.com", ScopePolicy{}, "ftp://example.com/file", false},
+		{"https://example.com", ScopePolicy{}, "/relative", false},
+
+		// exact host
+		{"https://www.example.com", ScopePolicy{Mode: ScopeExactHost}, "https://www.example.com/page", true},
+		{"https://www.example.com", ScopePolicy{Mode: ScopeExactHost}, "https://example.com", false},
+		{"https://example.com", ScopePolicy{Mode: ScopeExactHost}, "https://community.example.com", false},
+
+		// registrable domain
+		{"https://www.example.com", ScopePolicy{Mode: ScopeRegistrableDomain}, "https://example.com", true},
+		{"https://www.example.com", ScopePolicy{Mode: ScopeRegistrableDomain}, "https://blog.example.com", true},
+		{"https://www.example.com", ScopePolicy{Mode: ScopeRegistrableDomain}, "https://notexample.com", false},
+		{"https://www.example.co.uk", ScopePolicy{Mode: ScopeRegistrableDomain}, "https://shop.example.co.uk", true},
+		{"https://www.example.co.uk", ScopePolicy{Mode: ScopeRegistrableDomain}, "https://other.co.uk", false},
+		{"https://alice.github.io", ScopePolicy{Mode: ScopeRegistrableDomain}, "https://bob.github.io", false},
+		{"http://127.0.0.1:8080", ScopePolicy{Mode: ScopeRegistrableDomain}, "http://127.0.0.1:8080/page", true},
+		{"http://localhost", ScopePolicy{Mode: ScopeRegistrableDomain}, "http://localhost/page", true},
+
+		// allowlist
+		{"https://example.com", ScopePolicy{Mode: ScopeAllowlist, Hosts: []string{"docs.example.org", ".cdn.example.net"}}, "https://example.com", true},
+		{"https://example.com", ScopePolicy{Mode: ScopeAllowlist, Hosts: []string{"docs.example.org", ".cdn.example.net"}}, "https://docs.example.org/a", true},
+		{"https://example.com", ScopePolicy{Mode: ScopeAllowlist, Hosts: []string{"docs.example.org", ".cdn.example.net"}}, "https://blog.example.org/a", false},
+		{"https://example.com", ScopePolicy{Mode: ScopeAllowlist, Hosts: []string{"docs.example.org", ".cdn.example.net"}}, "https://eu.cdn.example.net/a", true},
+		{"https://example.com", ScopePolicy{Mode: ScopeAllowlist, Hosts: []string{"docs.example.org", ".cdn.example.net"}}, "https://community.example.com", false},
+
+		// schemes and ports
+		{"https://example.com", ScopePolicy{}, "http://example.com:8080", true},
+		{"https://example.com", ScopePolicy{MatchScheme: true}, "http://example.com", false},
+		{"https://example.com", ScopePolicy{MatchScheme: true}, "HTTPS://example.com", true},
+		{"https://example.com", ScopePolicy{MatchPort: true}, "https://example.com:443/page", true},
+		{"https://example.com", ScopePolicy{MatchPort: true}, "https://example.com:8443/page", false},
+		{"https://example.com", ScopePolicy{MatchPort: true}, "http://example.com/page", false},
+		{"http://example.com:8080", ScopePolicy{MatchPort: true}, "http://community.example.com:8080", true},
+	}
+
+	for _, tc := range tt {
+		entrypoint, err := url.Parse(tc.entrypoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := newScope(entrypoint, tc.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := url.Parse(tc.uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := s.contains(u)
+		if res != tc.res {
+			t.Errorf("expecting %s in the %s scope of %s (%+v) to be %v, got %v", tc.uri, tc.policy.Mode, tc.entrypoint, tc.policy, tc.res, res)
+		}
+	}
+}
+
+func TestParseScopeMode(t *testing.T) {
+	for _, m := range []ScopeMode{ScopeSubdomains, ScopeExactHost, ScopeRegistrableDomain, ScopeAllowlist} {
+		parsed, err := ParseScopeMode(m.String())
+		if err != nil {
+			t.Error(err)
+		}
+		if parsed != m {
+			t.Errorf("expecting %s to be parsed as %d, got %d", m, m, parsed)
+		}
+	}
+	if _, err := ParseScopeMode("everything"); err == nil {
+		t.Error("expecting an error parsing an unknown mode")
+	}
+}
@@ -0,0 +1,217 @@
+package seen
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+const (
+	// DefaultFalsePositiveRate is the default maximum probability of a BloomSet reporting an unseen URL as seen
+	DefaultFalsePositiveRate = 0.001
+	// DefaultBloomCapacity is the default number of URLs the first filter of a BloomSet is sized for
+	DefaultBloomCapacity = 100000
+	// tighteningRatio is how much stricter the false positive rate of each new filter is, so that the
+	// compound rate converges to the target one
+	tighteningRatio = 0.5
+	// growthFactor is how much bigger each new filter is
+	growthFactor = 2
+)
+
+// filter is a Bloom filter sized for a number of URLs and a false positive rate
+type filter struct {
+	Bits     []uint64
+	M        uint64
+	K        int
+	Capacity int
+	Count    int
+	// Ones is the number of bits set, used to estimate the false positive rate
+	Ones uint64
+}
+
+// newFilter returns a filter holding capacity URLs with the given false positive rate
+func newFilter(capacity int, fpRate float64) *filter {
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := int(math.Ceil(-math.Log2(fpRate)))
+	if k < 1 {
+		k = 1
+	}
+	return &filter{Bits: make([]uint64, (m+63)/64), M: m, K: k, Capacity: capacity}
+}
+
+// hashes returns the two hashes the positions of a URL are derived from, with double hashing
+func hashes(url string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(url))
+	h1 := h.Sum64()
+	// the splitmix64 finalizer makes a second independent-looking hash out of the first one
+	h2 := h1 + 0x9e3779b97f4a7c15
+	h2 = (h2 ^ (h2 >> 30)) * 0xbf58476d1ce4e5b9
+	h2 = (h2 ^ (h2 >> 27)) * 0x94d049bb133111eb
+	h2 ^= h2 >> 31
+	return h1, h2 | 1
+}
+
+// add sets the bits of a URL
+func (f *filter) add(h1, h2 uint64) {
+	for i := 0; i < f.K; i++ {
+		bit := (h1 + uint64(i)*h2) % f.M
+		mask := uint64(1) << (bit % 64)
+		if f.Bits[bit/64]&mask == 0 {
+			f.Bits[bit/64] |= mask
+			f.Ones++
+		}
+	}
+	f.Count++
+}
+
+// contains returns true if all the bits of a URL are set
+func (f *filter) contains(h1, h2 uint64) bool {
+	for i := 0; i < f.K; i++ {
+		bit := (h1 + uint64(i)*h2) % f.M
+		if f.Bits[bit/64]&(uint64(1)<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// falsePositiveRate estimates the false positive rate of the filter from the fraction of bits set
+func (f *filter) falsePositiveRate() float64 {
+	return math.Pow(float64(f.Ones)/float64(f.M), float64(f.K))
+}
+
+// BloomSet is an approximate set of URLs with bounded memory: a scalable Bloom filter, made of
+// filters which are added as the previous ones fill up, each bigger and stricter than the previous one.
+// A URL which has never been added can be reported as seen, and then won't be crawled, with a
+// probability bounded by the false positive rate. URLs which have been added are always reported as seen.
+type BloomSet struct {
+	fpRate  float64
+	filters []*filter
+	count   int
+	mux     *sync.RWMutex
+}
+
+// NewBloomSet returns a new BloomSet whose first filter holds capacity URLs, and whose false
+// positive rate stays below fpRate however many URLs are added
+func NewBloomSet(capacity int, fpRate float64) (*BloomSet, error) {
+	if capacity < 1 {
+		return nil, fmt.Errorf("invalid capacity %d, expecting a positive number of urls", capacity)
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		return nil, fmt.Errorf("invalid false positive rate %g, expecting a value between 0 and 1", fpRate)
+	}
+	return &BloomSet{
+		fpRate:  fpRate,
+		filters: []*filter{newFilter(capacity, fpRate*(1-tighteningRatio))},
+		mux:     &sync.RWMutex{},
+	}, nil
+}
+
+// contains returns true if a URL is in one of the filters
+func (s *BloomSet) contains(h1, h2 uint64) bool {
+	for _, f := range s.filters {
+		if f.contains(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add adds a URL to the set and returns true if it wasn't in it
+func (s *BloomSet) Add(url string) bool {
+	h1, h2 := hashes(url)
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.contains(h1, h2) {
+		return false
+	}
+	last := s.filters[len(s.filters)-1]
+	if last.Count >= last.Capacity {
+		fpRate := s.fpRate * (1 - tighteningRatio) * math.Pow(tighteningRatio, float64(len(s.filters)))
+		last = newFilter(last.Capacity*growthFactor, fpRate)
+		s.filters = append(s.filters, last)
+	}
+	last.add(h1, h2)
+	s.count++
+	return true
+}
+
+// Contains returns true if the URL has probably been added to the set
+func (s *BloomSet) Contains(url string) bool {
+	h1, h2 := hashes(url)
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.contains(h1, h2)
+}
+
+// Len returns the number of URLs added to the set, not counting the ones lost to false positives
+func (s *BloomSet) Len() int {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.count
+}
+
+// FalsePositiveRate returns the estimated probability of a URL which has never been added being reported as seen
+func (s *BloomSet) FalsePositiveRate() float64 {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	p := 1.0
+	for _, f := range s.filters {
+		p *= 1 - f.falsePositiveRate()
+	}
+	return 1 - p
+}
+
+// Size returns the memory used by the filters, in bytes
+func (s *BloomSet) Size() int {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	size := 0
+	for _, f := range s.filters {
+		size += len(f.Bits) * 8
+	}
+	return size
+}
+
+// bloomState is the encoding of a BloomSet
+type bloomState struct {
+	FPRate  float64
+	Filters []*filter
+	Count   int
+}
+
+// MarshalBinary encodes the filters, so that the set can be checkpointed
+func (s *BloomSet) MarshalBinary() ([]byte, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	var b bytes.Buffer
+	err := gob.NewEncoder(&b).Encode(bloomState{FPRate: s.fpRate, Filters: s.filters, Count: s.count})
+	return b.Bytes(), err
+}
+
+// UnmarshalBinary replaces the filters with the ones encoded by MarshalBinary
+func (s *BloomSet) UnmarshalBinary(data []byte) error {
+	var state bloomState
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); err != nil {
+		return fmt.Errorf("error decoding the bloom filter: %s", err)
+	}
+	if len(state.Filters) == 0 {
+		return fmt.Errorf("error decoding the bloom filter: no filters")
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.fpRate, s.filters, s.count = state.FPRate, state.Filters, state.Count
+	return nil
+}
+
+// Close releases the set
+func (s *BloomSet) Close() error {
+	return nil
+}
@@ -0,0 +1,173 @@
+package seen
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// diskBufferLen is the number of URLs added to a DiskSet which are written to disk in a single transaction
+const diskBufferLen = 10000
+
+// urlsBucket holds the URLs of a DiskSet as keys
+var urlsBucket = []byte("urls")
+
+// DiskSet is an exact set of URLs stored in a temporary bbolt database, for crawls whose seen URLs
+// don't fit in memory. URLs are buffered in memory and written to disk in batches.
+type DiskSet struct {
+	db     *bolt.DB
+	path   string
+	buffer map[string]struct{}
+	count  int
+	mux    *sync.RWMutex
+}
+
+// NewDiskSet returns a new DiskSet stored in a temporary file created in dir, or in the default
+// temporary directory if dir is empty. The file is removed by Close.
+func NewDiskSet(dir string) (*DiskSet, error) {
+	f, err := ioutil.TempFile(dir, "millipedes-seen-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating the seen set: %s", err)
+	}
+	f.Close()
+	// the set doesn't need to survive a crash, checkpoints save it
+	db, err := bolt.Open(f.Name(), 0600, &bolt.Options{NoSync: true, NoFreelistSync: true})
+	if err == nil {
+		err = db.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(urlsBucket)
+			return err
+		})
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, fmt.Errorf("error creating the seen set: %s", err)
+	}
+	return &DiskSet{
+		db:     db,
+		path:   f.Name(),
+		buffer: make(map[string]struct{}, diskBufferLen),
+		mux:    &sync.RWMutex{},
+	}, nil
+}
+
+// onDisk returns true if a URL has been written to disk
+func (s *DiskSet) onDisk(url string) bool {
+	found := false
+	s.db.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket(urlsBucket).Get([]byte(url)) != nil
+		return nil
+	})
+	return found
+}
+
+// flush writes the buffered URLs to disk
+func (s *DiskSet) flush() error {
+	if len(s.buffer) == 0 {
+		return nil
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(urlsBucket)
+		for url := range s.buffer {
+			if err := b.Put([]byte(url), []byte{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error writing the seen set: %s", err)
+	}
+	s.buffer = make(map[string]struct{}, diskBufferLen)
+	return nil
+}
+
+// Add adds a URL to the set and returns true if it wasn't in it. URLs are kept in memory if
+// they can't be written to disk.
+func (s *DiskSet) Add(url string) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if _, ok := s.buffer[url]; ok || s.onDisk(url) {
+		return false
+	}
+	s.buffer[url] = struct{}{}
+	s.count++
+	if len(s.buffer) >= diskBufferLen {
+		// the URLs are retried with the next batch
+		s.flush()
+	}
+	return true
+}
+
+// Remove removes a URL from the set
+func (s *DiskSet) Remove(url string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if _, ok := s.buffer[url]; ok {
+		delete(s.buffer, url)
+		s.count--
+		return
+	}
+	if !s.onDisk(url) {
+		return
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(urlsBucket).Delete([]byte(url))
+	})
+	if err != nil {
+		logrus.Errorf("error removing %s from the seen set: %s", url, err)
+		return
+	}
+	s.count--
+}
+
+// Contains returns true if the URL is in the set
+func (s *DiskSet) Contains(url string) bool {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	if _, ok := s.buffer[url]; ok {
+		return true
+	}
+	return s.onDisk(url)
+}
+
+// Len returns the number of URLs in the set
+func (s *DiskSet) Len() int {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.count
+}
+
+// Range calls fn for each URL of the set, in lexical order for the ones on disk, until it returns false
+func (s *DiskSet) Range(fn func(url string) bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.flush()
+	for url := range s.buffer {
+		if !fn(url) {
+			return
+		}
+	}
+	s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(urlsBucket).Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			if !fn(string(k)) {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+// Close closes and removes the database
+func (s *DiskSet) Close() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if err := s.db.Close(); err != nil {
+		return err
+	}
+	return os.Remove(s.path)
+}
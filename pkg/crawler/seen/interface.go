@@ -0,0 +1,22 @@
+package seen
+
+// Set is the interface of the set of URLs the crawler has already seen, so that each URL is
+// queued only once. Implementations must be safe for concurrent use.
+type Set interface {
+	// Add adds a URL to the set and returns true if it wasn't in it
+	Add(url string) bool
+	Contains(url string) bool
+	// Len returns the number of URLs added to the set
+	Len() int
+	Close() error
+}
+
+// Enumerable is implemented by the sets which store the URLs, and can list them until fn returns false
+type Enumerable interface {
+	Range(fn func(url string) bool)
+}
+
+// Remover is implemented by the sets which can remove a URL, e.g. one added with Add which couldn't be queued
+type Remover interface {
+	Remove(url string)
+}
@@ -0,0 +1,277 @@
+package seen
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// benchmarkURLs is the number of URLs the sets hold in the benchmarks
+const benchmarkURLs = 1000000
+
+func url(i int) string {
+	return fmt.Sprintf("https://example.com/section/%d/page-%d", i%1000, i)
+}
+
+// newSets returns an instance of each set, stored in dir when on disk
+func newSets(t testing.TB, dir string) map[string]Set {
+	bloom, err := NewBloomSet(DefaultBloomCapacity, DefaultFalsePositiveRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disk, err := NewDiskSet(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Set{"sharded": NewShardedSet(DefaultShards), "bloom": bloom, "disk": disk}
+}
+
+func TestSets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// more URLs than the disk buffer and the first bloom filter can hold
+	n := 3 * diskBufferLen
+	for name, s := range newSets(t, dir) {
+		var wg sync.WaitGroup
+		for w := 0; w < 4; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := w; i < n; i += 4 {
+					if !s.Add(url(i)) {
+						t.Errorf("%s: expecting %s to be new", name, url(i))
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+
+		if s.Add(url(0)) || s.Add(url(n-1)) {
+			t.Errorf("%s: expecting the URLs added to be seen", name)
+		}
+		for i := 0; i < n; i++ {
+			if !s.Contains(url(i)) {
+				t.Fatalf("%s: expecting %s to be in the set", name, url(i))
+			}
+		}
+		if s.Len() != n {
+			t.Errorf("%s: expecting %d URLs, got %d", name, n, s.Len())
+		}
+		if err := s.Close(); err != nil {
+			t.Errorf("%s: error closing the set: %s", name, err)
+		}
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 0 {
+		t.Errorf("expecting the disk set to be removed on close, got %d files", len(files))
+	}
+}
+
+func TestRange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	disk, err := NewDiskSet(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disk.Close()
+	for name, s := range map[string]Enumerable{"sharded": NewShardedSet(4), "disk": disk} {
+		expected := []string{}
+		for i := 0; i < diskBufferLen+10; i++ {
+			s.(Set).Add(url(i))
+			expected = append(expected, url(i))
+		}
+		urls := []string{}
+		s.Range(func(url string) bool {
+			urls = append(urls, url)
+			return true
+		})
+		sort.Strings(urls)
+		sort.Strings(expected)
+		if len(urls) != len(expected) || urls[0] != expected[0] || urls[len(urls)-1] != expected[len(expected)-1] {
+			t.Errorf("%s: expecting Range to list the %d URLs, got %d", name, len(expected), len(urls))
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	disk, err := NewDiskSet(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disk.Close()
+	for name, s := range map[string]Set{"sharded": NewShardedSet(4), "disk": disk} {
+		// the first URLs are written to disk, the last one is buffered
+		for i := 0; i <= diskBufferLen; i++ {
+			s.Add(url(i))
+		}
+		s.(Remover).Remove(url(0))
+		s.(Remover).Remove(url(diskBufferLen))
+		s.(Remover).Remove("https://example.com/missing")
+		if s.Contains(url(0)) || s.Contains(url(diskBufferLen)) || !s.Contains(url(1)) {
+			t.Errorf("%s: expecting only the URLs removed not to be in the set", name)
+		}
+		if s.Len() != diskBufferLen-1 {
+			t.Errorf("%s: expecting %d URLs, got %d", name, diskBufferLen-1, s.Len())
+		}
+		if !s.Add(url(0)) {
+			t.Errorf("%s: expecting a URL removed to be added again", name)
+		}
+	}
+}
+
+func TestBloomSetFalsePositiveRate(t *testing.T) {
+	fpRate := 0.01
+	s, err := NewBloomSet(1000, fpRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.FalsePositiveRate() != 0 {
+		t.Errorf("expecting no false positives on an empty set, got %f", s.FalsePositiveRate())
+	}
+	// the filter grows past its initial capacity
+	n := 20000
+	for i := 0; i < n; i++ {
+		s.Add(url(i))
+	}
+	if len(s.filters) < 2 {
+		t.Errorf("expecting the filter to scale, got %d filters", len(s.filters))
+	}
+
+	falsePositives := 0
+	for i := n; i < 2*n; i++ {
+		if s.Contains(url(i)) {
+			falsePositives++
+		}
+	}
+	measured := float64(falsePositives) / float64(n)
+	if measured > fpRate || s.FalsePositiveRate() > fpRate {
+		t.Errorf("expecting a false positive rate below %f, measured %f and estimated %f", fpRate, measured, s.FalsePositiveRate())
+	}
+
+	b, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, _ := NewBloomSet(1, 0.5)
+	if err := restored.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Len() != s.Len() || restored.FalsePositiveRate() != s.FalsePositiveRate() || !restored.Contains(url(0)) {
+		t.Errorf("expecting the set to be restored")
+	}
+
+	for _, rate := range []float64{0, 1, -0.1} {
+		if _, err := NewBloomSet(1000, rate); err == nil {
+			t.Errorf("expecting a false positive rate of %f to be invalid", rate)
+		}
+	}
+}
+
+var (
+	// benchmarkSets are the sets filled with benchmarkURLs, shared by the benchmarks since filling them is slow
+	benchmarkSets    map[string]Set
+	benchmarkSetsDir string
+	benchmarkSetsMux sync.Mutex
+)
+
+// filledSet returns a set of the given kind holding benchmarkURLs URLs
+func filledSet(b *testing.B, name string) Set {
+	benchmarkSetsMux.Lock()
+	defer benchmarkSetsMux.Unlock()
+	if benchmarkSets == nil {
+		dir, err := ioutil.TempDir("", "seen")
+		if err != nil {
+			b.Fatal(err)
+		}
+		benchmarkSetsDir = dir
+		benchmarkSets = newSets(b, dir)
+		for _, s := range benchmarkSets {
+			for i := 0; i < benchmarkURLs; i++ {
+				s.Add(url(i))
+			}
+		}
+	}
+	return benchmarkSets[name]
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	for _, s := range benchmarkSets {
+		s.Close()
+	}
+	if benchmarkSetsDir != "" {
+		os.RemoveAll(benchmarkSetsDir)
+	}
+	os.Exit(code)
+}
+
+// reportMemory reports the false positive rate and the memory used by a bloom set
+func reportMemory(b *testing.B, s Set) {
+	if bloom, ok := s.(*BloomSet); ok {
+		b.ReportMetric(bloom.FalsePositiveRate(), "fp-rate")
+		b.ReportMetric(float64(bloom.Size())/(1<<20), "MB")
+	}
+}
+
+func BenchmarkContains(b *testing.B) {
+	for _, name := range []string{"sharded", "bloom", "disk"} {
+		b.Run(name, func(b *testing.B) {
+			s := filledSet(b, name)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// half of the URLs are in the set
+				s.Contains(url(i % (2 * benchmarkURLs)))
+			}
+			reportMemory(b, s)
+		})
+	}
+}
+
+func BenchmarkContainsParallel(b *testing.B) {
+	for _, name := range []string{"sharded", "bloom", "disk"} {
+		b.Run(name, func(b *testing.B) {
+			s := filledSet(b, name)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					s.Contains(url(i % (2 * benchmarkURLs)))
+					i++
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkAdd(b *testing.B) {
+	for _, name := range []string{"sharded", "bloom", "disk"} {
+		b.Run(name, func(b *testing.B) {
+			s := filledSet(b, name)
+			offset := s.Len()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.Add(url(offset + i))
+			}
+			reportMemory(b, s)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package seen
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// DefaultShards is the number of shards of a ShardedSet, enough for 100 workers not to contend
+const DefaultShards = 64
+
+// shard is a part of a ShardedSet with its own lock
+type shard struct {
+	urls map[string]struct{}
+	mux  *sync.RWMutex
+}
+
+// ShardedSet is an exact in-memory set split in shards by the hash of the URLs, so that
+// concurrent workers rarely wait for each other
+type ShardedSet struct {
+	shards []shard
+}
+
+// NewShardedSet returns a new ShardedSet with the given number of shards
+func NewShardedSet(shards int) *ShardedSet {
+	if shards < 1 {
+		shards = 1
+	}
+	s := &ShardedSet{shards: make([]shard, shards)}
+	for i := range s.shards {
+		s.shards[i] = shard{urls: make(map[string]struct{}, 0), mux: &sync.RWMutex{}}
+	}
+	return s
+}
+
+// shard returns the shard a URL belongs to
+func (s *ShardedSet) shard(url string) *shard {
+	h := fnv.New32a()
+	h.Write([]byte(url))
+	return &s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+// Add adds a URL to the set and returns true if it wasn't in it
+func (s *ShardedSet) Add(url string) bool {
+	sh := s.shard(url)
+	sh.mux.Lock()
+	defer sh.mux.Unlock()
+	if _, ok := sh.urls[url]; ok {
+		return false
+	}
+	sh.urls[url] = struct{}{}
+	return true
+}
+
+// Remove removes a URL from the set
+func (s *ShardedSet) Remove(url string) {
+	sh := s.shard(url)
+	sh.mux.Lock()
+	delete(sh.urls, url)
+	sh.mux.Unlock()
+}
+
+// Contains returns true if the URL is in the set
+func (s *ShardedSet) Contains(url string) bool {
+	sh := s.shard(url)
+	sh.mux.RLock()
+	_, ok := sh.urls[url]
+	sh.mux.RUnlock()
+	return ok
+}
+
+// Len returns the number of URLs in the set
+func (s *ShardedSet) Len() int {
+	n := 0
+	for i := range s.shards {
+		s.shards[i].mux.RLock()
+		n += len(s.shards[i].urls)
+		s.shards[i].mux.RUnlock()
+	}
+	return n
+}
+
+// Range calls fn for each URL of the set, shard by shard, until it returns false
+func (s *ShardedSet) Range(fn func(url string) bool) {
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mux.RLock()
+		for url := range sh.urls {
+			if !fn(url) {
+				sh.mux.RUnlock()
+				return
+			}
+		}
+		sh.mux.RUnlock()
+	}
+}
+
+// Close releases the set
+func (s *ShardedSet) Close() error {
+	return nil
+}
@@ -0,0 +1,249 @@
+package sitemap
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// linksBucket holds the links from each url, JSON encoded
+	linksBucket = []byte("links")
+	// pagesBucket holds the information stored for each url, JSON encoded
+	pagesBucket = []byte("pages")
+)
+
+// initialMmapSize is the size of the memory mapping of the database reserved when it's opened. Snapshots
+// block the writes which need to grow the mapping until they're closed, reserving it avoids most of them.
+// Only the address space is reserved, the memory is used as the database grows.
+const initialMmapSize = 1 << 30
+
+// DiskSitemap is an implementation of a sitemap backend storing it in a bbolt database on disk,
+// so that the sitemap of a large website doesn't have to fit in memory and survives a restart.
+type DiskSitemap struct {
+	db *bolt.DB
+}
+
+// NewDiskSitemap returns a new DiskSitemap stored in the file at path, which is created if it
+// doesn't exist. The sitemap already stored in the file, if any, is kept.
+func NewDiskSitemap(path string) (*DiskSitemap, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second, InitialMmapSize: initialMmapSize})
+	if err != nil {
+		return nil, fmt.Errorf("error opening the sitemap %s: %s", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{linksBucket, pagesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error initialising the sitemap %s: %s", path, err)
+	}
+	return &DiskSitemap{db: db}, nil
+}
+
+// AddChildren adds new child pages to a url
+func (s *DiskSitemap) AddChildren(url string, children []string) {
+	links := make([]Link, 0, len(children))
+	for _, child := range children {
+		links = append(links, Link{URL: child})
+	}
+	s.AddLinks(url, links)
+}
+
+// AddLinks sets the links from a url to other pages
+func (s *DiskSitemap) AddLinks(url string, links []Link) {
+	v, err := json.Marshal(links)
+	if err != nil {
+		logrus.Errorf("error encoding the links of %s: %s", url, err)
+		return
+	}
+	// concurrent writes are batched in a single transaction
+	err = s.db.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket(linksBucket).Put([]byte(url), v)
+	})
+	if err != nil {
+		logrus.Errorf("error storing the links of %s: %s", url, err)
+	}
+}
+
+// IsURLPresent returns true if the URL has been stored already
+func (s *DiskSitemap) IsURLPresent(url string) bool {
+	ok := false
+	s.db.View(func(tx *bolt.Tx) error {
+		ok = tx.Bucket(linksBucket).Get([]byte(url)) != nil
+		return nil
+	})
+	if ok {
+		logrus.Debugf("%s already present", url)
+	}
+	return ok
+}
+
+// GetSitemap returns a map[string][]string representation of the sitemap
+func (s *DiskSitemap) GetSitemap() map[string][]string {
+	sitemap := make(map[string][]string, 0)
+	s.RangeLinks(func(url string, links []Link) bool {
+		children := make([]string, 0, len(links))
+		for _, l := range links {
+			children = append(children, l.URL)
+		}
+		sitemap[url] = children
+		return true
+	})
+	return sitemap
+}
+
+// GetLinks returns the links from each url
+func (s *DiskSitemap) GetLinks() map[string][]Link {
+	links := make(map[string][]Link, 0)
+	s.RangeLinks(func(url string, l []Link) bool {
+		links[url] = l
+		return true
+	})
+	return links
+}
+
+// RangeLinks calls fn with the links from each url, in lexical order, until it returns false
+func (s *DiskSitemap) RangeLinks(fn func(url string, links []Link) bool) {
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return rangeLinks(tx, fn)
+	})
+	if err != nil {
+		logrus.Error(err)
+	}
+}
+
+// rangeLinks calls fn with the links stored in a transaction, in lexical order, until it returns false
+func rangeLinks(tx *bolt.Tx, fn func(url string, links []Link) bool) error {
+	c := tx.Bucket(linksBucket).Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		links := []Link{}
+		if err := json.Unmarshal(v, &links); err != nil {
+			return fmt.Errorf("error decoding the links of %s: %s", k, err)
+		}
+		if !fn(string(k), links) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// UpdatePage applies an update to the information stored for a URL, creating it if needed.
+// The update can be applied more than once, if the transaction it's batched in fails.
+func (s *DiskSitemap) UpdatePage(url string, update func(p *Page)) {
+	err := s.db.Batch(func(tx *bolt.Tx) error {
+		b := tx.Bucket(pagesBucket)
+		p := &Page{URL: url}
+		if v := b.Get([]byte(url)); v != nil {
+			if err := json.Unmarshal(v, p); err != nil {
+				return fmt.Errorf("error decoding the page %s: %s", url, err)
+			}
+		}
+		update(p)
+		v, err := json.Marshal(p)
+		if err != nil {
+			return fmt.Errorf("error encoding the page %s: %s", url, err)
+		}
+		return b.Put([]byte(url), v)
+	})
+	if err != nil {
+		logrus.Errorf("error storing the page %s: %s", url, err)
+	}
+}
+
+// GetPages returns the information stored for each URL
+func (s *DiskSitemap) GetPages() map[string]Page {
+	pages := make(map[string]Page, 0)
+	s.RangePages(func(p Page) bool {
+		pages[p.URL] = p
+		return true
+	})
+	return pages
+}
+
+// RangePages calls fn with the information stored for each URL, in lexical order, until it returns false
+func (s *DiskSitemap) RangePages(fn func(p Page) bool) {
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return rangePages(tx, fn)
+	})
+	if err != nil {
+		logrus.Error(err)
+	}
+}
+
+// rangePages calls fn with the pages stored in a transaction, in lexical order, until it returns false
+func rangePages(tx *bolt.Tx, fn func(p Page) bool) error {
+	c := tx.Bucket(pagesBucket).Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		p := Page{}
+		if err := json.Unmarshal(v, &p); err != nil {
+			return fmt.Errorf("error decoding the page %s: %s", k, err)
+		}
+		if !fn(p) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Snapshot returns the sitemap as it is in a read-only transaction, without copying it. The writes
+// which need to grow the database beyond initialMmapSize wait for the snapshot to be closed.
+func (s *DiskSitemap) Snapshot() (Snapshot, error) {
+	tx, err := s.db.Begin(false)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the sitemap: %s", err)
+	}
+	return &diskSnapshot{tx: tx}, nil
+}
+
+// Clear removes all the links and pages of the sitemap
+func (s *DiskSitemap) Clear() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{linksBucket, pagesBucket} {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// diskSnapshot is a Snapshot of a DiskSitemap, reading it in a single transaction
+type diskSnapshot struct {
+	tx *bolt.Tx
+}
+
+// RangeLinks calls fn with the links from each url, in lexical order, until it returns false
+func (s *diskSnapshot) RangeLinks(fn func(url string, links []Link) bool) {
+	if err := rangeLinks(s.tx, fn); err != nil {
+		logrus.Error(err)
+	}
+}
+
+// RangePages calls fn with the information stored for each URL, in lexical order, until it returns false
+func (s *diskSnapshot) RangePages(fn func(p Page) bool) {
+	if err := rangePages(s.tx, fn); err != nil {
+		logrus.Error(err)
+	}
+}
+
+// Close ends the transaction of the snapshot
+func (s *diskSnapshot) Close() error {
+	return s.tx.Rollback()
+}
+
+// Close closes the database, flushing the sitemap to disk
+func (s *DiskSitemap) Close() error {
+	return s.db.Close()
+}
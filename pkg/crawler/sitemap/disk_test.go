@@ -0,0 +1,49 @@
+package sitemap
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestDiskSitemap(t *testing.T) {
+	path, cleanup := tempDiskSitemap(t)
+	defer cleanup()
+	disk, err := NewDiskSitemap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disk.Close()
+	memory := NewMemorySitemap()
+
+	// the pages are written concurrently, as the workers of a crawl do
+	for _, s := range []Sitemap{memory, disk} {
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				url := fmt.Sprintf("https://example.com/%d", i)
+				s.AddLinks(url, []Link{
+					{URL: fmt.Sprintf("https://example.com/%d", (i+1)%20), Kind: "anchor", Text: "next", Position: "main"},
+					{URL: "https://example.com/logo.png", Kind: "image"},
+				})
+				s.UpdatePage(url, func(p *Page) {
+					p.Depth = i
+					p.Status = 200
+					p.Resource = ResourceHTML
+				})
+				s.UpdatePage(url, func(p *Page) { p.NoIndex = i%2 == 0 })
+			}(i)
+		}
+		wg.Wait()
+	}
+
+	if !reflect.DeepEqual(disk.GetLinks(), memory.GetLinks()) {
+		t.Errorf("expecting the same sitemap on disk and in memory, got %v and %v", disk.GetLinks(), memory.GetLinks())
+	}
+	if !reflect.DeepEqual(disk.GetPages(), memory.GetPages()) {
+		t.Errorf("expecting the same pages on disk and in memory, got %v and %v", disk.GetPages(), memory.GetPages())
+	}
+}
@@ -0,0 +1,235 @@
+package sitemap
+
+import (
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Node is a URL of the sitemap, either crawled or only known as the target of a link
+type Node struct {
+	// Page is everything stored about the URL, only its URL is set if Stored is false
+	Page
+	// Stored is false for the URLs only known as the target of a link
+	Stored bool
+}
+
+// Edge is a link from a page to another URL, with the attributes it was found with
+type Edge struct {
+	Source string
+	Target string
+	// Kind is the kind of link, e.g. anchor or image, empty for redirects
+	Kind string
+	// Redirect is the status code of a redirect, 0 for the links found in a page
+	Redirect int
+	Nofollow bool
+	Text     string
+	Title    string
+	Rel      string
+	Position string
+}
+
+// newEdge returns the edge of a link from source
+func newEdge(source string, l Link) Edge {
+	return Edge{
+		Source:   source,
+		Target:   l.URL,
+		Kind:     l.Kind,
+		Redirect: l.Redirect,
+		Nofollow: l.Nofollow,
+		Text:     l.Text,
+		Title:    l.Title,
+		Rel:      l.Rel,
+		Position: l.Position,
+	}
+}
+
+// link returns the link an edge was built from
+func (e Edge) link() Link {
+	return Link{
+		URL:      e.Target,
+		Kind:     e.Kind,
+		Redirect: e.Redirect,
+		Nofollow: e.Nofollow,
+		Text:     e.Text,
+		Title:    e.Title,
+		Rel:      e.Rel,
+		Position: e.Position,
+	}
+}
+
+// Graph is a snapshot of a sitemap as nodes and edges. It's a copy, so it can be read while the
+// crawl goes on and isn't affected by it.
+type Graph struct {
+	nodes map[string]*Node
+	urls  []string
+	// crawled are the URLs whose links have been stored, even if they have none
+	crawled  map[string]bool
+	outbound map[string][]Edge
+	inbound  map[string][]Edge
+}
+
+// NewGraph returns a snapshot of the sitemap, with the links and the pages as they were at the same time
+func NewGraph(s Sitemap) *Graph {
+	g := &Graph{
+		nodes:    make(map[string]*Node, 0),
+		crawled:  make(map[string]bool, 0),
+		outbound: make(map[string][]Edge, 0),
+		inbound:  make(map[string][]Edge, 0),
+	}
+	var r Snapshot = s
+	snapshot, err := s.Snapshot()
+	if err != nil {
+		logrus.Errorf("%s, the links and the pages may not be consistent", err)
+	} else {
+		defer snapshot.Close()
+		r = snapshot
+	}
+
+	r.RangeLinks(func(url string, links []Link) bool {
+		g.node(url)
+		g.crawled[url] = true
+		for _, l := range links {
+			g.node(l.URL)
+			e := newEdge(url, l)
+			g.outbound[url] = append(g.outbound[url], e)
+			g.inbound[l.URL] = append(g.inbound[l.URL], e)
+		}
+		return true
+	})
+	// the pages are copies already
+	r.RangePages(func(p Page) bool {
+		n := g.node(p.URL)
+		n.Page, n.Stored = p, true
+		return true
+	})
+
+	for url := range g.nodes {
+		g.urls = append(g.urls, url)
+	}
+	sort.Strings(g.urls)
+	// sitemaps aren't ordered, inbound edges are sorted by source so that snapshots are comparable
+	for _, edges := range g.inbound {
+		sort.SliceStable(edges, func(i, j int) bool { return edges[i].Source < edges[j].Source })
+	}
+	return g
+}
+
+// node returns the node of a URL, creating it if needed
+func (g *Graph) node(url string) *Node {
+	n, ok := g.nodes[url]
+	if !ok {
+		n = &Node{Page: Page{URL: url}}
+		g.nodes[url] = n
+	}
+	return n
+}
+
+// Len returns the number of nodes of the graph
+func (g *Graph) Len() int {
+	return len(g.urls)
+}
+
+// Node returns the node of a URL
+func (g *Graph) Node(url string) (Node, bool) {
+	n, ok := g.nodes[url]
+	if !ok {
+		return Node{}, false
+	}
+	return *n, true
+}
+
+// RangeNodes calls fn for each node, sorted by URL, until it returns false
+func (g *Graph) RangeNodes(fn func(n Node) bool) {
+	for _, url := range g.urls {
+		if !fn(*g.nodes[url]) {
+			return
+		}
+	}
+}
+
+// RangeEdges calls fn for each edge, sorted by source and in the order the links were found, until it returns false
+func (g *Graph) RangeEdges(fn func(e Edge) bool) {
+	for _, url := range g.urls {
+		for _, e := range g.outbound[url] {
+			if !fn(e) {
+				return
+			}
+		}
+	}
+}
+
+// RangeLinks calls fn for each URL whose links have been stored, sorted, with its links until it returns false
+func (g *Graph) RangeLinks(fn func(url string, links []Link) bool) {
+	for _, url := range g.urls {
+		if !g.crawled[url] {
+			continue
+		}
+		links := make([]Link, 0, len(g.outbound[url]))
+		for _, e := range g.outbound[url] {
+			links = append(links, e.link())
+		}
+		if !fn(url, links) {
+			return
+		}
+	}
+}
+
+// RangePages calls fn for each stored page, sorted by URL, until it returns false
+func (g *Graph) RangePages(fn func(p Page) bool) {
+	for _, url := range g.urls {
+		n := g.nodes[url]
+		if n.Stored && !fn(n.Page.clone()) {
+			return
+		}
+	}
+}
+
+// Outbound returns the edges from a URL, in the order the links were found
+func (g *Graph) Outbound(url string) []Edge {
+	edges := make([]Edge, len(g.outbound[url]))
+	copy(edges, g.outbound[url])
+	return edges
+}
+
+// Inbound returns the edges to a URL, sorted by source
+func (g *Graph) Inbound(url string) []Edge {
+	edges := make([]Edge, len(g.inbound[url]))
+	copy(edges, g.inbound[url])
+	return edges
+}
+
+// Children returns the graph in the format of Sitemap.GetSitemap, for the renders which haven't migrated yet
+func (g *Graph) Children() map[string][]string {
+	children := make(map[string][]string, len(g.crawled))
+	for url := range g.crawled {
+		children[url] = make([]string, 0, len(g.outbound[url]))
+		for _, e := range g.outbound[url] {
+			children[url] = append(children[url], e.Target)
+		}
+	}
+	return children
+}
+
+// Links returns the graph in the format of Sitemap.GetLinks, for the renders which haven't migrated yet
+func (g *Graph) Links() map[string][]Link {
+	links := make(map[string][]Link, len(g.crawled))
+	for url := range g.crawled {
+		links[url] = make([]Link, 0, len(g.outbound[url]))
+		for _, e := range g.outbound[url] {
+			links[url] = append(links[url], e.link())
+		}
+	}
+	return links
+}
+
+// Pages returns the nodes in the format of Sitemap.GetPages, for the renders which haven't migrated yet
+func (g *Graph) Pages() map[string]Page {
+	pages := make(map[string]Page, 0)
+	for url, n := range g.nodes {
+		if n.Stored {
+			pages[url] = n.Page.clone()
+		}
+	}
+	return pages
+}
@@ -0,0 +1,178 @@
+package sitemap
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// testSitemap returns a small sitemap with a redirect, a page linking to itself and a broken link
+func testSitemap() Sitemap {
+	s := NewMemorySitemap()
+	s.AddLinks("https://example.com", []Link{
+		{URL: "https://example.com/a", Kind: "anchor", Text: "A", Position: "nav"},
+		{URL: "https://example.com/b", Redirect: 301},
+	})
+	s.AddLinks("https://example.com/a", []Link{{URL: "https://example.com", Kind: "anchor"}, {URL: "https://example.com/broken", Kind: "anchor", Nofollow: true}})
+	s.AddLinks("https://example.com/b", []Link{{URL: "https://example.com/broken", Kind: "image"}})
+	s.UpdatePage("https://example.com", func(p *Page) {
+		p.Status = 200
+		p.Response = &Response{Status: 200}
+		p.Metadata = &Metadata{Title: "Home"}
+	})
+	s.UpdatePage("https://example.com/a", func(p *Page) { p.Depth = 1 })
+	s.UpdatePage("https://example.com/broken", func(p *Page) {
+		p.Depth = 2
+		p.Error = "connection refused"
+	})
+	return s
+}
+
+func TestGraphNodes(t *testing.T) {
+	g := NewGraph(testSitemap())
+
+	urls := []string{}
+	g.RangeNodes(func(n Node) bool {
+		urls = append(urls, n.URL)
+		return true
+	})
+	expected := []string{"https://example.com", "https://example.com/a", "https://example.com/b", "https://example.com/broken"}
+	if !reflect.DeepEqual(urls, expected) || g.Len() != len(expected) {
+		t.Errorf("expecting nodes %v, got %v", expected, urls)
+	}
+
+	tt := []struct {
+		url      string
+		status   int
+		depth    int
+		err      string
+		title    string
+		hasPage  bool
+		expected bool
+	}{
+		{url: "https://example.com", status: 200, title: "Home", hasPage: true, expected: true},
+		{url: "https://example.com/a", depth: 1, hasPage: true, expected: true},
+		{url: "https://example.com/b", expected: true},
+		{url: "https://example.com/broken", depth: 2, err: "connection refused", hasPage: true, expected: true},
+		{url: "https://example.com/missing"},
+	}
+	for _, tc := range tt {
+		n, ok := g.Node(tc.url)
+		if ok != tc.expected {
+			t.Errorf("%s: expecting node to be found %t, got %t", tc.url, tc.expected, ok)
+			continue
+		}
+		if n.Status != tc.status || n.Depth != tc.depth || n.Error != tc.err || n.Stored != tc.hasPage {
+			t.Errorf("%s: unexpected node %+v", tc.url, n)
+		}
+		title := ""
+		if n.Metadata != nil {
+			title = n.Metadata.Title
+		}
+		if title != tc.title {
+			t.Errorf("%s: expecting title %q, got %+v", tc.url, tc.title, n.Metadata)
+		}
+	}
+}
+
+func TestGraphEdges(t *testing.T) {
+	g := NewGraph(testSitemap())
+
+	edges := []string{}
+	g.RangeEdges(func(e Edge) bool {
+		edges = append(edges, e.Source+" -> "+e.Target)
+		return true
+	})
+	expected := []string{
+		"https://example.com -> https://example.com/a",
+		"https://example.com -> https://example.com/b",
+		"https://example.com/a -> https://example.com",
+		"https://example.com/a -> https://example.com/broken",
+		"https://example.com/b -> https://example.com/broken",
+	}
+	if !reflect.DeepEqual(edges, expected) {
+		t.Errorf("expecting edges %v, got %v", expected, edges)
+	}
+
+	expectedOut := []Edge{
+		{Source: "https://example.com", Target: "https://example.com/a", Kind: "anchor", Text: "A", Position: "nav"},
+		{Source: "https://example.com", Target: "https://example.com/b", Redirect: 301},
+	}
+	if out := g.Outbound("https://example.com"); !reflect.DeepEqual(out, expectedOut) {
+		t.Errorf("expecting outbound edges %+v, got %+v", expectedOut, out)
+	}
+	expectedIn := []Edge{
+		{Source: "https://example.com/a", Target: "https://example.com/broken", Kind: "anchor", Nofollow: true},
+		{Source: "https://example.com/b", Target: "https://example.com/broken", Kind: "image"},
+	}
+	if in := g.Inbound("https://example.com/broken"); !reflect.DeepEqual(in, expectedIn) {
+		t.Errorf("expecting inbound edges %+v, got %+v", expectedIn, in)
+	}
+	if out := g.Outbound("https://example.com/broken"); len(out) != 0 {
+		t.Errorf("expecting no outbound edges from a page which wasn't crawled, got %+v", out)
+	}
+
+	// the returned edges are copies
+	g.Inbound("https://example.com/broken")[0].Target = "changed"
+	if in := g.Inbound("https://example.com/broken"); in[0].Target != "https://example.com/broken" {
+		t.Errorf("expecting the graph not to be modified through its edges, got %+v", in)
+	}
+}
+
+func TestGraphAdapters(t *testing.T) {
+	s := testSitemap()
+	g := NewGraph(s)
+	if children := g.Children(); !reflect.DeepEqual(children, s.GetSitemap()) {
+		t.Errorf("expecting children %v, got %v", s.GetSitemap(), children)
+	}
+	if links := g.Links(); !reflect.DeepEqual(links, s.GetLinks()) {
+		t.Errorf("expecting links %v, got %v", s.GetLinks(), links)
+	}
+	if pages := g.Pages(); !reflect.DeepEqual(pages, s.GetPages()) {
+		t.Errorf("expecting pages %v, got %v", s.GetPages(), pages)
+	}
+}
+
+func TestGraphSnapshot(t *testing.T) {
+	s := testSitemap()
+	g := NewGraph(s)
+	s.AddLinks("https://example.com/broken", []Link{{URL: "https://example.com/c"}})
+	s.UpdatePage("https://example.com", func(p *Page) {
+		p.Response.Status = 500
+		p.Metadata.Title = "Changed"
+	})
+	if _, ok := g.Node("https://example.com/c"); ok {
+		t.Errorf("expecting the graph not to change with the sitemap")
+	}
+	if n, _ := g.Node("https://example.com"); n.Status != 200 || n.Metadata.Title != "Home" || n.Response.Status != 200 {
+		t.Errorf("expecting the graph not to change with the sitemap, got %+v", n)
+	}
+
+	// snapshots can be taken while the sitemap is being written
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				url := fmt.Sprintf("https://example.com/%d/%d", i, j)
+				s.AddLinks(url, []Link{{URL: "https://example.com"}})
+				s.UpdatePage("https://example.com", func(p *Page) {
+					p.Warnings = append(p.Warnings, url)
+					p.Metadata.Headings = append(p.Metadata.Headings, Heading{Level: 1, Text: url})
+				})
+			}
+		}(i)
+	}
+	for i := 0; i < 10; i++ {
+		g := NewGraph(s)
+		g.RangeNodes(func(n Node) bool {
+			if n.Stored && n.Metadata != nil {
+				_ = len(n.Warnings) + len(n.Metadata.Headings)
+			}
+			return true
+		})
+	}
+	wg.Wait()
+}
@@ -3,6 +3,33 @@ package sitemap
 // Sitemap is an interfaces that represents a backend where to store the sitemap
 type Sitemap interface {
 	AddChildren(url string, children []string)
+	AddLinks(url string, links []Link)
 	IsURLPresent(url string) bool
 	GetSitemap() map[string][]string
+	GetLinks() map[string][]Link
+	UpdatePage(url string, update func(p *Page))
+	GetPages() map[string]Page
+	// RangeLinks and RangePages stream the sitemap until fn returns false, fn must not modify it
+	RangeLinks(fn func(url string, links []Link) bool)
+	RangePages(fn func(p Page) bool)
+	// Snapshot returns the sitemap as it is, unaffected by the writes which follow
+	Snapshot() (Snapshot, error)
+	Close() error
+}
+
+// Ranger streams the links and the pages of a sitemap, e.g. a Sitemap, a Snapshot or a Graph
+type Ranger interface {
+	RangeLinks(fn func(url string, links []Link) bool)
+	RangePages(fn func(p Page) bool)
+}
+
+// Snapshot is a read-only view of a sitemap at a point in time, which must be closed once read
+type Snapshot interface {
+	Ranger
+	Close() error
+}
+
+// Clearer is a Sitemap which can be emptied, e.g. a sitemap reopened from disk to restore a checkpoint into it
+type Clearer interface {
+	Clear() error
 }
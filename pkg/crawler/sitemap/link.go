@@ -0,0 +1,21 @@
+package sitemap
+
+// Link is an edge of the sitemap, from a page to another URL
+type Link struct {
+	// URL is the target of the link
+	URL string `json:"url"`
+	// Kind is the kind of a link found in a page, e.g. anchor or image
+	Kind string `json:"kind,omitempty"`
+	// Nofollow is true if the link has rel="nofollow" or its page has a nofollow robots directive
+	Nofollow bool `json:"nofollow,omitempty"`
+	// Redirect is the status code of a redirect, 0 for the links found in a page
+	Redirect int `json:"redirect,omitempty"`
+	// Text is the anchor text of the link
+	Text string `json:"text,omitempty"`
+	// Title is the title attribute of the link
+	Title string `json:"title,omitempty"`
+	// Rel is the rel attribute of the link
+	Rel string `json:"rel,omitempty"`
+	// Position is the landmark of the page containing the link: header, nav, main or footer
+	Position string `json:"position,omitempty"`
+}
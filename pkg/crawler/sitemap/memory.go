@@ -8,29 +8,40 @@ import (
 
 // MemorySitemap is an in-memory implementation of a sitemap backend
 type MemorySitemap struct {
-	sitemap    map[string][]string
+	links      map[string][]Link
+	pages      map[string]*Page
 	sitemapMux *sync.RWMutex
 }
 
 // NewMemorySitemap returns a new MemorySitemap
 func NewMemorySitemap() *MemorySitemap {
 	return &MemorySitemap{
-		sitemap:    make(map[string][]string, 0),
+		links:      make(map[string][]Link, 0),
+		pages:      make(map[string]*Page, 0),
 		sitemapMux: &sync.RWMutex{},
 	}
 }
 
 // AddChildren adds new child pages to a url
 func (s *MemorySitemap) AddChildren(url string, children []string) {
+	links := make([]Link, 0, len(children))
+	for _, child := range children {
+		links = append(links, Link{URL: child})
+	}
+	s.AddLinks(url, links)
+}
+
+// AddLinks sets the links from a url to other pages
+func (s *MemorySitemap) AddLinks(url string, links []Link) {
 	s.sitemapMux.Lock()
-	s.sitemap[url] = children
+	s.links[url] = links
 	s.sitemapMux.Unlock()
 }
 
 // IsURLPresent returns true if the URL has been stored already
 func (s *MemorySitemap) IsURLPresent(url string) bool {
 	s.sitemapMux.RLock()
-	_, ok := s.sitemap[url]
+	_, ok := s.links[url]
 	s.sitemapMux.RUnlock()
 	if ok {
 		logrus.Infof("%s already present", url)
@@ -40,5 +51,96 @@ func (s *MemorySitemap) IsURLPresent(url string) bool {
 
 // GetSitemap returns a map[string][]string representation of the sitemap
 func (s *MemorySitemap) GetSitemap() map[string][]string {
-	return s.sitemap
+	s.sitemapMux.RLock()
+	sitemap := make(map[string][]string, len(s.links))
+	for url, links := range s.links {
+		children := make([]string, 0, len(links))
+		for _, l := range links {
+			children = append(children, l.URL)
+		}
+		sitemap[url] = children
+	}
+	s.sitemapMux.RUnlock()
+	return sitemap
+}
+
+// GetLinks returns a copy of the links from each url
+func (s *MemorySitemap) GetLinks() map[string][]Link {
+	s.sitemapMux.RLock()
+	links := make(map[string][]Link, len(s.links))
+	for url, l := range s.links {
+		links[url] = make([]Link, len(l))
+		copy(links[url], l)
+	}
+	s.sitemapMux.RUnlock()
+	return links
+}
+
+// UpdatePage applies an update to the information stored for a URL, creating it if needed
+func (s *MemorySitemap) UpdatePage(url string, update func(p *Page)) {
+	s.sitemapMux.Lock()
+	p, ok := s.pages[url]
+	if !ok {
+		p = &Page{URL: url}
+		s.pages[url] = p
+	}
+	update(p)
+	s.sitemapMux.Unlock()
+}
+
+// GetPages returns a copy of the information stored for each URL
+func (s *MemorySitemap) GetPages() map[string]Page {
+	s.sitemapMux.RLock()
+	pages := make(map[string]Page, len(s.pages))
+	for url, p := range s.pages {
+		pages[url] = p.clone()
+	}
+	s.sitemapMux.RUnlock()
+	return pages
+}
+
+// RangeLinks calls fn with the links from each url, until it returns false
+func (s *MemorySitemap) RangeLinks(fn func(url string, links []Link) bool) {
+	s.sitemapMux.RLock()
+	defer s.sitemapMux.RUnlock()
+	for url, l := range s.links {
+		links := make([]Link, len(l))
+		copy(links, l)
+		if !fn(url, links) {
+			return
+		}
+	}
+}
+
+// RangePages calls fn with a copy of the information stored for each URL, until it returns false
+func (s *MemorySitemap) RangePages(fn func(p Page) bool) {
+	s.sitemapMux.RLock()
+	defer s.sitemapMux.RUnlock()
+	for _, p := range s.pages {
+		if !fn(p.clone()) {
+			return
+		}
+	}
+}
+
+// Snapshot returns a copy of the sitemap, taken under a single lock so that the links and the pages are consistent
+func (s *MemorySitemap) Snapshot() (Snapshot, error) {
+	s.sitemapMux.RLock()
+	defer s.sitemapMux.RUnlock()
+	snapshot := NewMemorySitemap()
+	for url, l := range s.links {
+		links := make([]Link, len(l))
+		copy(links, l)
+		snapshot.links[url] = links
+	}
+	for url, p := range s.pages {
+		page := p.clone()
+		snapshot.pages[url] = &page
+	}
+	return snapshot, nil
+}
+
+// Close releases the sitemap, there's nothing to flush
+func (s *MemorySitemap) Close() error {
+	return nil
 }
@@ -0,0 +1,180 @@
+package sitemap
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	// ReasonRobots is the reason set on pages that weren't crawled because robots.txt disallows them
+	ReasonRobots = "blocked by robots"
+	// ReasonFiltered is the reason set on pages that weren't crawled because of the include/exclude rules
+	ReasonFiltered = "filtered"
+)
+
+// Resource types of the pages, derived from their content type
+const (
+	ResourceHTML       = "html"
+	ResourceImage      = "image"
+	ResourceVideo      = "video"
+	ResourceAudio      = "audio"
+	ResourcePDF        = "pdf"
+	ResourceStylesheet = "stylesheet"
+	ResourceScript     = "script"
+	ResourceFont       = "font"
+	ResourceArchive    = "archive"
+	ResourceText       = "text"
+	ResourceOther      = "other"
+)
+
+// ResourceType returns the type of resource of a media type, e.g. image for image/png
+func ResourceType(mediaType string) string {
+	switch mediaType {
+	case "text/html", "application/xhtml+xml":
+		return ResourceHTML
+	case "application/pdf":
+		return ResourcePDF
+	case "text/css":
+		return ResourceStylesheet
+	case "text/javascript", "application/javascript", "application/x-javascript":
+		return ResourceScript
+	case "application/zip", "application/gzip", "application/x-gzip", "application/x-tar",
+		"application/x-rar-compressed", "application/x-7z-compressed", "application/x-bzip2":
+		return ResourceArchive
+	}
+	switch strings.SplitN(mediaType, "/", 2)[0] {
+	case "image":
+		return ResourceImage
+	case "video":
+		return ResourceVideo
+	case "audio":
+		return ResourceAudio
+	case "font":
+		return ResourceFont
+	case "text":
+		return ResourceText
+	}
+	return ResourceOther
+}
+
+// Page holds the information collected about a single URL of the sitemap
+type Page struct {
+	URL string `json:"url"`
+	// Depth is the number of links followed from the entrypoint to reach the page
+	Depth int `json:"depth"`
+	// Skipped is the reason why the page hasn't been crawled, if any
+	Skipped string `json:"skipped,omitempty"`
+	// Status is the HTTP status code of the last attempt to fetch the page, including the failed
+	// ones the server replied to, e.g. 404, and redirects
+	Status int `json:"status,omitempty"`
+	// Error is the error returned by the last attempt to fetch the page, if it failed
+	Error string `json:"error,omitempty"`
+	// ErrorKind classifies the error, e.g. timeout or http status, empty if it's unknown
+	ErrorKind string `json:"error_kind,omitempty"`
+	// Attempts is the number of times fetching the page has been attempted, when it failed
+	Attempts int `json:"attempts,omitempty"`
+	// NoIndex is true if the page asks not to be indexed, with <meta name="robots"> or X-Robots-Tag
+	NoIndex bool `json:"noindex,omitempty"`
+	// NoFollow is true if the page asks for its links not to be followed
+	NoFollow bool `json:"nofollow,omitempty"`
+	// Resource is the type of resource of a fetched page, only HTML pages have children
+	Resource string `json:"resource,omitempty"`
+	// Response holds the metadata of the response the page was fetched with
+	Response *Response `json:"response,omitempty"`
+	// NonNavigable are the links of the page which can't be crawled, e.g. mailto: or javascript:
+	NonNavigable []Link `json:"non_navigable,omitempty"`
+	// Warnings are the problems found parsing the page, e.g. malformed links
+	Warnings []string `json:"warnings,omitempty"`
+	// Metadata describes a HTML page, e.g. its title and headings
+	Metadata *Metadata `json:"metadata,omitempty"`
+}
+
+// Broken returns true if the page couldn't be fetched
+func (p Page) Broken() bool {
+	return p.Error != ""
+}
+
+// Metadata holds the information describing a HTML page, found while parsing it
+type Metadata struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Headings is the outline of the page, made of its H1, H2 and H3 headings in document order
+	Headings []Heading `json:"headings,omitempty"`
+	// Canonical is the absolute URL of the <link rel="canonical"> of the page
+	Canonical string `json:"canonical,omitempty"`
+	Lang      string `json:"lang,omitempty"`
+	// Charset is the encoding the page was decoded from
+	Charset string `json:"charset,omitempty"`
+	// OpenGraph are the Open Graph properties of the page, e.g. og:title
+	OpenGraph map[string]string `json:"open_graph,omitempty"`
+	// Twitter are the Twitter card properties of the page, e.g. twitter:card
+	Twitter map[string]string `json:"twitter,omitempty"`
+	// WordCount is the number of words of the visible text of the page
+	WordCount int `json:"word_count"`
+}
+
+// Heading is a H1, H2 or H3 heading of a page
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+}
+
+// Response holds the metadata of the response a page was fetched with
+type Response struct {
+	Status int `json:"status"`
+	// FinalURL is the URL the page was read from, after following the redirects
+	FinalURL    string              `json:"final_url"`
+	Redirects   []Redirect          `json:"redirects,omitempty"`
+	Header      map[string][]string `json:"header,omitempty"`
+	ContentType string              `json:"content_type,omitempty"`
+	Size        int64               `json:"size"`
+	Latency     time.Duration       `json:"latency"`
+	DNS         time.Duration       `json:"dns,omitempty"`
+	Connect     time.Duration       `json:"connect,omitempty"`
+	TLS         time.Duration       `json:"tls,omitempty"`
+	TTFB        time.Duration       `json:"ttfb,omitempty"`
+}
+
+// Redirect is a hop of the redirect chain followed to fetch a page
+type Redirect struct {
+	URL    string `json:"url"`
+	To     string `json:"to"`
+	Status int    `json:"status"`
+}
+
+// clone returns a deep copy of the page, so that it isn't affected by later updates
+func (p Page) clone() Page {
+	if p.Response != nil {
+		r := *p.Response
+		r.Redirects = append([]Redirect(nil), r.Redirects...)
+		if r.Header != nil {
+			r.Header = make(map[string][]string, len(p.Response.Header))
+			for k, v := range p.Response.Header {
+				r.Header[k] = append([]string(nil), v...)
+			}
+		}
+		p.Response = &r
+	}
+	if p.Metadata != nil {
+		m := *p.Metadata
+		m.Headings = append([]Heading(nil), m.Headings...)
+		m.OpenGraph = cloneStrings(m.OpenGraph)
+		m.Twitter = cloneStrings(m.Twitter)
+		p.Metadata = &m
+	}
+	p.NonNavigable = append([]Link(nil), p.NonNavigable...)
+	p.Warnings = append([]string(nil), p.Warnings...)
+	return p
+}
+
+// cloneStrings returns a copy of a map of strings
+func cloneStrings(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,169 @@
+package sitemap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// tempDiskSitemap returns a DiskSitemap stored in a temporary directory, and a function removing it
+func tempDiskSitemap(t testing.TB) (string, func()) {
+	dir, err := ioutil.TempDir("", "millipedes-sitemap-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "sitemap.db"), func() { os.RemoveAll(dir) }
+}
+
+func TestSitemaps(t *testing.T) {
+	path, cleanup := tempDiskSitemap(t)
+	defer cleanup()
+	disk, err := NewDiskSitemap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disk.Close()
+
+	for name, s := range map[string]Sitemap{"memory": NewMemorySitemap(), "disk": disk} {
+		s.AddLinks("https://example.com", []Link{{URL: "https://example.com/a", Kind: "anchor", Text: "A"}, {URL: "https://example.com/b", Redirect: 301}})
+		s.AddChildren("https://example.com/a", nil)
+		s.UpdatePage("https://example.com", func(p *Page) { p.Depth = 1 })
+		s.UpdatePage("https://example.com", func(p *Page) { p.Attempts++ })
+
+		if !s.IsURLPresent("https://example.com/a") || s.IsURLPresent("https://example.com/b") {
+			t.Errorf("%s: expecting only the pages with links to be present", name)
+		}
+		expected := map[string][]string{
+			"https://example.com":   {"https://example.com/a", "https://example.com/b"},
+			"https://example.com/a": {},
+		}
+		if sm := s.GetSitemap(); !reflect.DeepEqual(sm, expected) {
+			t.Errorf("%s: expecting sitemap %v, got %v", name, expected, sm)
+		}
+		links := s.GetLinks()
+		if l := links["https://example.com"]; len(l) != 2 || l[0].Text != "A" || l[1].Redirect != 301 {
+			t.Errorf("%s: expecting the links attributes to be stored, got %+v", name, l)
+		}
+		expectedPage := Page{URL: "https://example.com", Depth: 1, Attempts: 1}
+		if p := s.GetPages()["https://example.com"]; !reflect.DeepEqual(p, expectedPage) {
+			t.Errorf("%s: expecting page %+v, got %+v", name, expectedPage, p)
+		}
+
+		urls := []string{}
+		s.RangeLinks(func(url string, links []Link) bool {
+			urls = append(urls, url)
+			return false
+		})
+		if len(urls) != 1 {
+			t.Errorf("%s: expecting RangeLinks to stop when fn returns false, got %v", name, urls)
+		}
+	}
+}
+
+func TestDiskSitemapReopen(t *testing.T) {
+	path, cleanup := tempDiskSitemap(t)
+	defer cleanup()
+	s, err := NewDiskSitemap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for _, url := range []string{"https://example.com", "https://example.com/a", "https://example.com/b"} {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			s.AddChildren(url, []string{"https://example.com"})
+			s.UpdatePage(url, func(p *Page) { p.Resource = ResourceHTML })
+		}(url)
+	}
+	wg.Wait()
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewDiskSitemap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	pages := []string{}
+	s.RangePages(func(p Page) bool {
+		if p.Resource != ResourceHTML {
+			t.Errorf("expecting the page to be stored, got %+v", p)
+		}
+		pages = append(pages, p.URL)
+		return true
+	})
+	if !sort.StringsAreSorted(pages) || len(pages) != 3 {
+		t.Errorf("expecting the pages to survive reopening the sitemap, got %v", pages)
+	}
+	if len(s.GetSitemap()) != 3 {
+		t.Errorf("expecting the links to survive reopening the sitemap, got %v", s.GetSitemap())
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	path, cleanup := tempDiskSitemap(t)
+	defer cleanup()
+	disk, err := NewDiskSitemap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disk.Close()
+
+	for name, s := range map[string]Sitemap{"memory": NewMemorySitemap(), "disk": disk} {
+		s.AddChildren("https://example.com", []string{"https://example.com/a"})
+		s.UpdatePage("https://example.com", func(p *Page) { p.Depth = 1 })
+		snapshot, err := s.Snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.AddChildren("https://example.com/a", nil)
+		s.UpdatePage("https://example.com", func(p *Page) { p.Depth = 2 })
+
+		urls := []string{}
+		snapshot.RangeLinks(func(url string, links []Link) bool {
+			urls = append(urls, url)
+			return true
+		})
+		pages := []Page{}
+		snapshot.RangePages(func(p Page) bool {
+			pages = append(pages, p)
+			return true
+		})
+		if len(urls) != 1 || len(pages) != 1 || pages[0].Depth != 1 {
+			t.Errorf("%s: expecting the snapshot not to change with the sitemap, got %v and %+v", name, urls, pages)
+		}
+		if err := snapshot.Close(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestDiskSitemapClear(t *testing.T) {
+	path, cleanup := tempDiskSitemap(t)
+	defer cleanup()
+	s, err := NewDiskSitemap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.AddChildren("https://example.com", []string{"https://example.com/a"})
+	s.UpdatePage("https://example.com", func(p *Page) { p.Depth = 1 })
+
+	if err := s.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.GetLinks()) != 0 || len(s.GetPages()) != 0 {
+		t.Errorf("expecting the sitemap to be empty, got %v and %v", s.GetLinks(), s.GetPages())
+	}
+	s.AddChildren("https://example.com", nil)
+	if !s.IsURLPresent("https://example.com") {
+		t.Error("expecting the sitemap to be usable once cleared")
+	}
+}